@@ -0,0 +1,120 @@
+package hash
+
+//
+// Bulk operations of UintMap.
+// Keys are processed in chunks of batchSize. Chunk keys are hashed first and the home slot
+// of every key is loaded, so the cache misses of the whole chunk overlap instead of being paid
+// one after another. Then the chunk is sorted by hash code, which groups keys by directory
+// index, and applied in bucket order, each bucket is visited once while it is in cache.
+// Sorting is stable, so repeated keys are applied in input order and results are the same
+// as of one-at-a-time calls.
+//
+
+// prefix: uum
+
+// number of keys hashed and prefetched at once
+const batchSize = 64
+
+type batchItem struct {
+	hash  uint
+	index int  // position of the key in the chunk
+	first uint // key found in home slot by the prefetch pass
+}
+
+// prepareBatch hashes chunk keys, touches their home slots and sorts chunk in bucket order
+func (m *UintMap) prepareBatch(keys []uint, items *[batchSize]batchItem) []batchItem {
+	shift := bitsPerHashCode - m.dirBits
+	for i, k := range keys {
+		h := m.hash(k)
+		items[i] = batchItem{hash: h, index: i, first: m.dir[h>>shift].entries[h%entriesPerHashBucket].key}
+	}
+	chunk := items[:len(keys)]
+	// insertion sort: stable and cheap for batchSize items
+	for i := 1; i < len(chunk); i++ {
+		it := chunk[i]
+		j := i
+		for ; j > 0 && chunk[j-1].hash > it.hash; j-- {
+			chunk[j] = chunk[j-1]
+		}
+		chunk[j] = it
+	}
+	return chunk
+}
+
+// GetMany stores values of keys into out, zero for missing keys
+func (m *UintMap) GetMany(keys, out []uint) {
+	if len(out) < len(keys) {
+		panic("output is shorter than keys")
+	}
+	var items [batchSize]batchItem
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		chunk := m.prepareBatch(keys[:n], &items)
+		shift := bitsPerHashCode - m.dirBits
+		for _, it := range chunk {
+			i := it.index
+			key := keys[i]
+			if key == 0 {
+				out[i] = m.Get(0)
+				continue
+			}
+			if it.first == key {
+				out[i] = m.dir[it.hash>>shift].entries[it.hash%entriesPerHashBucket].value
+				continue
+			}
+			if e := m.findHashed(key, it.hash, false); e != nil {
+				out[i] = e.value
+			} else {
+				out[i] = 0
+			}
+		}
+		keys, out = keys[n:], out[n:]
+	}
+}
+
+// PutMany puts values[i] for keys[i]. If a key repeats, its last value wins.
+func (m *UintMap) PutMany(keys, values []uint) {
+	if len(values) != len(keys) {
+		panic("keys and values length mismatch")
+	}
+	var items [batchSize]batchItem
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		for _, it := range m.prepareBatch(keys[:n], &items) {
+			if key := keys[it.index]; key == 0 {
+				m.Put(0, values[it.index])
+			} else {
+				m.findHashed(key, it.hash, true).value = values[it.index]
+			}
+		}
+		keys, values = keys[n:], values[n:]
+	}
+}
+
+// IncMany increments value of keys[i] by deltas[i]
+func (m *UintMap) IncMany(keys, deltas []uint) {
+	if len(deltas) != len(keys) {
+		panic("keys and deltas length mismatch")
+	}
+	var items [batchSize]batchItem
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+		for _, it := range m.prepareBatch(keys[:n], &items) {
+			if key := keys[it.index]; key == 0 {
+				m.Inc(0, deltas[it.index])
+			} else {
+				m.findHashed(key, it.hash, true).value += deltas[it.index]
+			}
+		}
+		keys, deltas = keys[n:], deltas[n:]
+	}
+}
@@ -0,0 +1,116 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/pi/goal/th"
+	"github.com/stretchr/testify/assert"
+)
+
+func batchKeys(n int, period uint) []uint {
+	g := th.NewSeqGen(th.SgRand)
+	g.SetPeriod(period)
+	keys := make([]uint, n)
+	for i := range keys {
+		keys[i] = g.Next()
+	}
+	// zero key and repeated keys within a chunk
+	keys[3] = 0
+	keys[10] = keys[5]
+	keys[11] = keys[5]
+	return keys
+}
+
+func Test_UintMapBatch(t *testing.T) {
+	const n = 100000
+	keys := batchKeys(n, n/4)
+	values := make([]uint, n)
+	for i := range values {
+		values[i] = uint(i) + 1
+	}
+
+	m1, m2 := NewUintMap(), NewUintMap()
+	for i, k := range keys {
+		m1.Put(k, values[i])
+	}
+	m2.PutMany(keys, values)
+	assert.Equal(t, m1.Len(), m2.Len())
+	for i, k := range keys {
+		m1.Inc(k, values[i])
+	}
+	m2.IncMany(keys, values)
+
+	out := make([]uint, n+1)
+	probe := append(keys[:n:n], 12345678)
+	m2.GetMany(probe, out)
+	for i, k := range probe {
+		assert.Equal(t, m1.Get(k), out[i])
+	}
+	m1.Do(func(k, v uint) {
+		assert.Equal(t, v, m2.Get(k))
+	})
+
+	var items [batchSize]batchItem
+	chunk := m2.prepareBatch(keys[:batchSize], &items)
+	for i := 1; i < len(chunk); i++ {
+		// bucket order, repeated keys keep input order
+		assert.True(t, chunk[i-1].hash < chunk[i].hash ||
+			chunk[i-1].hash == chunk[i].hash && chunk[i-1].index < chunk[i].index)
+	}
+
+	assert.Panics(t, func() { m2.PutMany(keys, values[1:]) })
+	assert.Panics(t, func() { m2.GetMany(keys, out[:10]) })
+}
+
+const batchBenchSize = 1 << 20
+
+var benchSink uint
+
+func Benchmark_UintMapInc(b *testing.B) {
+	keys := batchKeys(batchBenchSize, batchBenchSize)
+	m := NewUintMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			m.Inc(k, 1)
+		}
+	}
+}
+
+func Benchmark_UintMapIncMany(b *testing.B) {
+	keys := batchKeys(batchBenchSize, batchBenchSize)
+	deltas := make([]uint, len(keys))
+	for i := range deltas {
+		deltas[i] = 1
+	}
+	m := NewUintMap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.IncMany(keys, deltas)
+	}
+}
+
+func Benchmark_UintMapGet(b *testing.B) {
+	keys := batchKeys(batchBenchSize, batchBenchSize)
+	m := NewUintMap()
+	m.PutMany(keys, keys)
+	b.ResetTimer()
+	var sum uint
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			sum += m.Get(k)
+		}
+	}
+	benchSink = sum
+}
+
+func Benchmark_UintMapGetMany(b *testing.B) {
+	keys := batchKeys(batchBenchSize, batchBenchSize)
+	out := make([]uint, len(keys))
+	m := NewUintMap()
+	m.PutMany(keys, keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.GetMany(keys, out)
+	}
+}
@@ -0,0 +1,330 @@
+package hash
+
+//
+// Bloom filters for uint and []byte keys.
+//
+// Bit positions come from double hashing: h1 is mix64 of uintHashCode of the key (of bytesHashCode
+// for byte keys), h2 is h1 with swapped halves, and position i is h1 + i*h2 mapped to the filter
+// range by multiply-shift. uintHashCode alone is linear, so hash codes of sequential keys form
+// a lattice and raise the false positive rate several times.
+//
+// BlockedBloomFilter sets all bits of a key within one 512-bit block aligned to a cache line,
+// so an operation costs one cache miss instead of k. The block is chosen by h1, positions in it
+// are 9-bit pieces of h2: double hashing in such a small range correlates keys too much.
+// Every group of 7 positions takes a fresh word mixed from h2 and the group number.
+// Blocks fill unevenly, which raises the false positive rate at the same size;
+// NewBlockedBloomFilter compensates by computing the rate of the blocked layout and adding
+// blocks until the target is met (usually 10-30% more memory). The computed rate ignores variance
+// of block fill and is about 10% optimistic.
+//
+// Filters with the same parameters can be combined by Union. Zero value filters are usable
+// only as UnmarshalBinary targets.
+//
+
+// prefix: bloom
+
+import (
+	"math"
+	"math/bits"
+	"unsafe"
+)
+
+const (
+	bloomMaxHashes  = 32
+	bloomBlockBits  = 512
+	bloomBlockWords = bloomBlockBits / 64
+	bloomPosPerWord = 64 / 9 // positions in block taken from one hash word
+)
+
+var (
+	bloomFilterMagic        = [4]byte{'G', 'B', 'L', 'F'}
+	blockedBloomFilterMagic = [4]byte{'G', 'B', 'B', 'F'}
+)
+
+// bloomHashes returns double hashing pair for hash code h
+func bloomHashes(h uint) (uint, uint) {
+	h = mix64(h)
+	return h, bits.RotateLeft(h, 32) | 1
+}
+
+// bloomRange maps h to [0, n)
+func bloomRange(h, n uint) uint {
+	hi, _ := bits.Mul64(uint64(h), uint64(n))
+	return uint(hi)
+}
+
+// bloomSize returns optimal number of bits and hashes for n elements and false positive rate p
+func bloomSize(n uint, p float64) (m, k uint) {
+	if !(p > 0 && p < 1) {
+		panic("invalid false positive rate")
+	}
+	if n == 0 {
+		n = 1
+	}
+	m = uint(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	return m, bloomHashesFor(float64(m) / float64(n))
+}
+
+// bloomHashesFor returns optimal number of hashes for given bits per element
+func bloomHashesFor(bitsPerElement float64) uint {
+	k := uint(math.Round(bitsPerElement * math.Ln2))
+	if k < 1 {
+		k = 1
+	} else if k > bloomMaxHashes {
+		k = bloomMaxHashes
+	}
+	return k
+}
+
+// BloomFilter is the classic Bloom filter
+type BloomFilter struct {
+	words []uint64
+	bits  uint
+	k     uint
+}
+
+// NewBloomFilter creates filter for n elements with false positive rate p
+func NewBloomFilter(n uint, p float64) *BloomFilter {
+	m, k := bloomSize(n, p)
+	words := (m + 63) / 64
+	return &BloomFilter{words: make([]uint64, words), bits: words * 64, k: k}
+}
+
+func (f *BloomFilter) add(h uint) {
+	h1, h2 := bloomHashes(h)
+	for i := uint(0); i < f.k; i++ {
+		pos := bloomRange(h1, f.bits)
+		f.words[pos/64] |= 1 << (pos % 64)
+		h1 += h2
+	}
+}
+
+func (f *BloomFilter) contains(h uint) bool {
+	h1, h2 := bloomHashes(h)
+	for i := uint(0); i < f.k; i++ {
+		pos := bloomRange(h1, f.bits)
+		if f.words[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+		h1 += h2
+	}
+	return true
+}
+
+func (f *BloomFilter) Add(key uint) {
+	f.add(uintHashCode(key))
+}
+
+// Contains reports whether key may have been added. False means it certainly was not.
+func (f *BloomFilter) Contains(key uint) bool {
+	return f.contains(uintHashCode(key))
+}
+
+func (f *BloomFilter) AddBytes(key []byte) {
+	f.add(bytesHashCode(key))
+}
+
+func (f *BloomFilter) ContainsBytes(key []byte) bool {
+	return f.contains(bytesHashCode(key))
+}
+
+// Bits returns size of the filter in bits
+func (f *BloomFilter) Bits() uint {
+	return f.bits
+}
+
+// Hashes returns number of bits set per key
+func (f *BloomFilter) Hashes() uint {
+	return f.k
+}
+
+func (f *BloomFilter) Clear() {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+}
+
+// Union adds all keys of o to f. Filters must have the same parameters.
+func (f *BloomFilter) Union(o *BloomFilter) error {
+	if f.bits != o.bits || f.k != o.k {
+		return SketchMismatchError
+	}
+	for i, w := range o.words {
+		f.words[i] |= w
+	}
+	return nil
+}
+
+func (f *BloomFilter) MarshalBinary() ([]byte, error) {
+	return sketchEncode(bloomFilterMagic, []uint64{uint64(f.bits), uint64(f.k)}, f.words), nil
+}
+
+func (f *BloomFilter) UnmarshalBinary(data []byte) error {
+	params, words, err := sketchDecode(data, bloomFilterMagic, 2)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 || params[0] != uint64(len(words))*64 || params[1] < 1 || params[1] > bloomMaxHashes {
+		return SnapshotFormatError
+	}
+	f.words, f.bits, f.k = words, uint(params[0]), uint(params[1])
+	return nil
+}
+
+// BlockedBloomFilter is Bloom filter with all bits of a key in one cache line
+type BlockedBloomFilter struct {
+	words  []uint64 // aligned to cache line
+	blocks uint
+	k      uint
+}
+
+// blockedBloomRate returns false positive rate of blocks with k hashes after adding n elements.
+// Number of elements in a block is Poisson distributed.
+func blockedBloomRate(n, blocks, k uint) float64 {
+	mean := float64(n) / float64(blocks)
+	spread := 8*math.Sqrt(mean) + 16
+	lo, hi := math.Max(0, math.Floor(mean-spread)), mean+spread
+	rate := 0.0
+	for i := lo; i <= hi; i++ {
+		lg, _ := math.Lgamma(i + 1)
+		poisson := math.Exp(i*math.Log(mean) - mean - lg)
+		rate += poisson * math.Pow(1-math.Pow(1-1.0/bloomBlockBits, i*float64(k)), float64(k))
+	}
+	return rate
+}
+
+// blockedBloomSize returns number of blocks and hashes for n elements and false positive rate p
+func blockedBloomSize(n uint, p float64) (blocks, k uint) {
+	m, _ := bloomSize(n, p)
+	if n == 0 {
+		n = 1
+	}
+	blocks = (m + bloomBlockBits - 1) / bloomBlockBits
+	for {
+		best := 1.0
+		for h := uint(1); h <= bloomMaxHashes; h++ {
+			if rate := blockedBloomRate(n, blocks, h); rate < best {
+				best, k = rate, h
+			}
+		}
+		if best <= p {
+			return blocks, k
+		}
+		blocks += blocks/32 + 1
+	}
+}
+
+// alignedBlocks allocates n blocks starting at cache line boundary
+func alignedBlocks(n uint) []uint64 {
+	raw := make([]uint64, n*bloomBlockWords+bloomBlockWords-1)
+	off := (bloomBlockBits/8 - uintptr(unsafe.Pointer(&raw[0]))%(bloomBlockBits/8)) % (bloomBlockBits / 8) / 8
+	return raw[off : off+uintptr(n*bloomBlockWords)]
+}
+
+// NewBlockedBloomFilter creates blocked filter for n elements with false positive rate p
+func NewBlockedBloomFilter(n uint, p float64) *BlockedBloomFilter {
+	blocks, k := blockedBloomSize(n, p)
+	return &BlockedBloomFilter{words: alignedBlocks(blocks), blocks: blocks, k: k}
+}
+
+// block returns block of hash code h and bits for positions in it
+func (f *BlockedBloomFilter) block(h uint) ([]uint64, uint) {
+	h = mix64(h)
+	b := bloomRange(h, f.blocks) * bloomBlockWords
+	return f.words[b : b+bloomBlockWords], mix64(h)
+}
+
+// bloomBlockPos takes position i in block from bits x, reseeding x from seed when its bits
+// are used up
+func bloomBlockPos(i, seed uint, x *uint) uint {
+	if i%bloomPosPerWord == 0 && i > 0 {
+		*x = mix64(seed + i/bloomPosPerWord*bytesHashPrime1)
+	}
+	p := *x % bloomBlockBits
+	*x /= bloomBlockBits
+	return p
+}
+
+func (f *BlockedBloomFilter) add(h uint) {
+	block, seed := f.block(h)
+	x := seed
+	for i := uint(0); i < f.k; i++ {
+		p := bloomBlockPos(i, seed, &x)
+		block[p/64] |= 1 << (p % 64)
+	}
+}
+
+func (f *BlockedBloomFilter) contains(h uint) bool {
+	block, seed := f.block(h)
+	x := seed
+	for i := uint(0); i < f.k; i++ {
+		p := bloomBlockPos(i, seed, &x)
+		if block[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *BlockedBloomFilter) Add(key uint) {
+	f.add(uintHashCode(key))
+}
+
+// Contains reports whether key may have been added. False means it certainly was not.
+func (f *BlockedBloomFilter) Contains(key uint) bool {
+	return f.contains(uintHashCode(key))
+}
+
+func (f *BlockedBloomFilter) AddBytes(key []byte) {
+	f.add(bytesHashCode(key))
+}
+
+func (f *BlockedBloomFilter) ContainsBytes(key []byte) bool {
+	return f.contains(bytesHashCode(key))
+}
+
+// Bits returns size of the filter in bits
+func (f *BlockedBloomFilter) Bits() uint {
+	return f.blocks * bloomBlockBits
+}
+
+// Hashes returns number of bits set per key
+func (f *BlockedBloomFilter) Hashes() uint {
+	return f.k
+}
+
+func (f *BlockedBloomFilter) Clear() {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+}
+
+// Union adds all keys of o to f. Filters must have the same parameters.
+func (f *BlockedBloomFilter) Union(o *BlockedBloomFilter) error {
+	if f.blocks != o.blocks || f.k != o.k {
+		return SketchMismatchError
+	}
+	for i, w := range o.words {
+		f.words[i] |= w
+	}
+	return nil
+}
+
+func (f *BlockedBloomFilter) MarshalBinary() ([]byte, error) {
+	return sketchEncode(blockedBloomFilterMagic, []uint64{uint64(f.blocks), uint64(f.k)}, f.words), nil
+}
+
+func (f *BlockedBloomFilter) UnmarshalBinary(data []byte) error {
+	params, words, err := sketchDecode(data, blockedBloomFilterMagic, 2)
+	if err != nil {
+		return err
+	}
+	blocks := params[0]
+	if blocks == 0 || uint64(len(words)) != blocks*bloomBlockWords || params[1] < 1 || params[1] > bloomMaxHashes {
+		return SnapshotFormatError
+	}
+	f.words = alignedBlocks(uint(blocks))
+	copy(f.words, words)
+	f.blocks, f.k = uint(blocks), uint(params[1])
+	return nil
+}
@@ -0,0 +1,161 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bloomRate adds n keys and returns measured false positive rate
+func bloomRate(t *testing.T, add func(uint), contains func(uint) bool, n uint) float64 {
+	return bloomRateProbes(t, add, contains, n, 200000)
+}
+
+// bloomRateProbes is bloomRate with given number of probes
+func bloomRateProbes(t *testing.T, add func(uint), contains func(uint) bool, n, probes uint) float64 {
+	for i := uint(0); i < n; i++ {
+		add(i * 7)
+	}
+	for i := uint(0); i < n; i++ {
+		if !contains(i * 7) {
+			t.Fatalf("false negative %d", i*7)
+		}
+	}
+	fp := 0
+	for i := uint(0); i < probes; i++ {
+		if contains(i*7 + 3) {
+			fp++
+		}
+	}
+	return float64(fp) / float64(probes)
+}
+
+func Test_BloomFilter(t *testing.T) {
+	for _, p := range []float64{0.1, 0.01, 0.001} {
+		f := NewBloomFilter(100000, p)
+		rate := bloomRate(t, f.Add, f.Contains, 100000)
+		assert.True(t, rate < p*1.3, "p %v: rate %v", p, rate)
+		b := NewBlockedBloomFilter(100000, p)
+		assert.True(t, b.Bits() >= f.Bits())
+		rate = bloomRate(t, b.Add, b.Contains, 100000)
+		assert.True(t, rate < p*1.3, "blocked p %v: rate %v", p, rate)
+		assert.Equal(t, uintptr(0), uintptr(unsafe.Pointer(&b.words[0]))%64)
+	}
+	assert.Panics(t, func() { NewBloomFilter(10, 0) })
+	assert.Panics(t, func() { NewBlockedBloomFilter(10, 1) })
+}
+
+func Test_BlockedBloomFilterManyHashes(t *testing.T) {
+	// more hashes than positions taken from one word
+	for _, p := range []float64{1e-4, 1e-5} {
+		b := NewBlockedBloomFilter(100000, p)
+		assert.True(t, b.Hashes() > bloomPosPerWord)
+		rate := bloomRateProbes(t, b.Add, b.Contains, 100000, uint(300/p))
+		assert.True(t, rate < p*1.3, "p %v, k %d: rate %v", p, b.Hashes(), rate)
+	}
+}
+
+func Test_BloomFilterBytes(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	b := NewBlockedBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.AddBytes([]byte("key" + strconv.Itoa(i)))
+		b.AddBytes([]byte("key" + strconv.Itoa(i)))
+	}
+	fp, bfp := 0, 0
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.ContainsBytes([]byte("key"+strconv.Itoa(i))))
+		assert.True(t, b.ContainsBytes([]byte("key"+strconv.Itoa(i))))
+		if f.ContainsBytes([]byte("other" + strconv.Itoa(i))) {
+			fp++
+		}
+		if b.ContainsBytes([]byte("other" + strconv.Itoa(i))) {
+			bfp++
+		}
+	}
+	assert.True(t, fp < 30 && bfp < 30)
+}
+
+func Test_BloomFilterUnion(t *testing.T) {
+	a, b := NewBloomFilter(1000, 0.01), NewBloomFilter(1000, 0.01)
+	ba, bb := NewBlockedBloomFilter(1000, 0.01), NewBlockedBloomFilter(1000, 0.01)
+	for i := uint(0); i < 500; i++ {
+		a.Add(i)
+		ba.Add(i)
+		b.Add(i + 500)
+		bb.Add(i + 500)
+	}
+	assert.NoError(t, a.Union(b))
+	assert.NoError(t, ba.Union(bb))
+	for i := uint(0); i < 1000; i++ {
+		assert.True(t, a.Contains(i))
+		assert.True(t, ba.Contains(i))
+	}
+	assert.Equal(t, SketchMismatchError, a.Union(NewBloomFilter(2000, 0.01)))
+	assert.Equal(t, SketchMismatchError, ba.Union(NewBlockedBloomFilter(2000, 0.01)))
+	a.Clear()
+	assert.False(t, a.Contains(1))
+}
+
+func Test_BloomFilterMarshal(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	b := NewBlockedBloomFilter(1000, 0.01)
+	for i := uint(0); i < 1000; i++ {
+		f.Add(i)
+		b.Add(i)
+	}
+	data, err := f.MarshalBinary()
+	assert.NoError(t, err)
+	var g BloomFilter
+	assert.NoError(t, g.UnmarshalBinary(data))
+	assert.Equal(t, f.Bits(), g.Bits())
+	assert.Equal(t, f.Hashes(), g.Hashes())
+	for i := uint(0); i < 1000; i++ {
+		assert.True(t, g.Contains(i))
+	}
+	data[len(data)-5] ^= 1
+	assert.Equal(t, SnapshotChecksumError, g.UnmarshalBinary(data))
+	assert.Equal(t, SnapshotFormatError, g.UnmarshalBinary(data[:10]))
+
+	data, err = b.MarshalBinary()
+	assert.NoError(t, err)
+	var c BlockedBloomFilter
+	assert.NoError(t, c.UnmarshalBinary(data))
+	assert.Equal(t, b.Bits(), c.Bits())
+	for i := uint(0); i < 1000; i++ {
+		assert.True(t, c.Contains(i))
+	}
+	assert.Equal(t, SnapshotFormatError, g.UnmarshalBinary(data))
+}
+
+func Benchmark_BloomFilterContains(b *testing.B) {
+	f := NewBloomFilter(1<<22, 0.01)
+	for i := uint(0); i < 1<<22; i++ {
+		f.Add(i)
+	}
+	b.ResetTimer()
+	n := 0
+	for i := 0; i < b.N; i++ {
+		if f.Contains(uint(i) * 3) {
+			n++
+		}
+	}
+	benchSink = uint(n)
+}
+
+func Benchmark_BlockedBloomFilterContains(b *testing.B) {
+	f := NewBlockedBloomFilter(1<<22, 0.01)
+	for i := uint(0); i < 1<<22; i++ {
+		f.Add(i)
+	}
+	b.ResetTimer()
+	n := 0
+	for i := 0; i < b.N; i++ {
+		if f.Contains(uint(i) * 3) {
+			n++
+		}
+	}
+	benchSink = uint(n)
+}
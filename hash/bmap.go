@@ -0,0 +1,393 @@
+package hash
+
+//
+// BytesMap
+// Dense map of []byte->uint. Implemented using extendible hashing mechanism.
+// Keys are copied into append-only arena, buckets keep only hash code, arena offset and value,
+// so buckets contain no pointers and splits never rehash keys.
+// Keys are hashed by bytesHashCode. With a Hasher option the hash is seeded by the hasher,
+// so that keys crafted to collide are not known in advance. Entries whose full hash codes are
+// equal can't be separated by splitting: more than entriesPerHashBucket such keys make Put
+// panic with HashCollisionError.
+//
+
+// prefix: bm
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// minimal arena size to consider repacking
+const bmMinRepackSize = 64 * 1024
+
+type bmEntry struct {
+	hash  uint // full hash code of the key
+	off   uint // offset of the key in arena, 0 marks empty slot
+	value uint
+}
+
+type bmBucket struct {
+	bits    uint
+	count   uint
+	entries [entriesPerHashBucket]bmEntry
+}
+
+type BytesMapIterator struct {
+	m               *BytesMap
+	started         bool
+	curBucketIndex  int
+	curElementIndex int
+}
+
+func (it *BytesMapIterator) Reset() {
+	it.started = false
+}
+
+func (it *BytesMapIterator) Next() bool {
+	if !it.started {
+		it.started = true
+		it.curBucketIndex = 0
+		it.curElementIndex = -1
+	}
+	if it.curBucketIndex == len(it.m.dir) {
+		return false
+	}
+	for {
+		it.curElementIndex++
+		if it.curElementIndex == entriesPerHashBucket {
+			it.curElementIndex = 0
+			for {
+				it.curBucketIndex++
+				if it.curBucketIndex == len(it.m.dir) {
+					return false
+				}
+				if it.m.dir[it.curBucketIndex] != it.m.dir[it.curBucketIndex-1] {
+					break
+				}
+			}
+		}
+		if it.m.dir[it.curBucketIndex].entries[it.curElementIndex].off != 0 {
+			return true
+		}
+	}
+}
+
+// Return current map key. Returned slice points into the map's arena and must not be modified.
+func (it *BytesMapIterator) CurKey() []byte {
+	if !it.started {
+		panic("accessing unstarted iterator")
+	}
+	return it.m.keyAt(it.m.dir[it.curBucketIndex].entries[it.curElementIndex].off)
+}
+
+// Return current map value. Panic if the iterator has not been started.
+func (it *BytesMapIterator) Cur() uint {
+	if !it.started {
+		panic("accessing unstarted iter")
+	}
+	return it.m.dir[it.curBucketIndex].entries[it.curElementIndex].value
+}
+
+type BytesMap struct {
+	dirBits uint
+	dir     []*bmBucket
+	count   uint
+	arena   []byte // length prefixed keys
+	garbage uint   // arena bytes occupied by deleted keys
+	hasher  Hasher
+	seed    uint // seed of key hash codes, derived from hasher
+}
+
+// NewBytesMap creates map. Optional arguments are initial directory bits and Hasher seeding key hash codes.
+func NewBytesMap(args ...interface{}) *BytesMap {
+	const usage = "usage: NewBytesMap([initDirBits], [hasher])"
+	o := parseContainerOptions(args, usage)
+	o.plainOnly(usage)
+	m := &BytesMap{hasher: o.hasher}
+	if o.hasher != nil {
+		m.seed = o.hasher.Hash(bytesHashPrime2)
+	}
+	m.init(o.dirBitsOption())
+	return m
+}
+
+func (m *BytesMap) hash(key []byte) uint {
+	return seededBytesHashCode(key, m.seed)
+}
+
+func (m *BytesMap) init(bits uint) {
+	initSize := 1 << bits
+	m.dirBits = bits
+	m.dir = make([]*bmBucket, initSize)
+	m.count = 0
+	// fresh arena: keys handed out by iterators keep pointing into the old one
+	m.arena = make([]byte, 1, 4096) // offset 0 is reserved for empty slots
+	m.garbage = 0
+
+	firstBucket := &bmBucket{}
+
+	for i := 0; i < initSize; i++ {
+		m.dir[i] = firstBucket
+	}
+}
+
+func (m *BytesMap) Clear() {
+	m.init(defaultHashDirBits)
+}
+
+func (m *BytesMap) Iterator() BytesMapIterator {
+	return BytesMapIterator{m: m}
+}
+func (m *BytesMap) Get(key []byte) uint {
+	e := m.find(key, m.hash(key), false)
+	if e == nil {
+		return 0
+	}
+	return e.value
+}
+func (m *BytesMap) Put(key []byte, value uint) {
+	m.find(key, m.hash(key), true).value = value
+}
+func (m *BytesMap) Inc(key []byte, delta uint) {
+	m.find(key, m.hash(key), true).value += delta
+}
+func (m *BytesMap) Dec(key []byte, delta uint) {
+	m.find(key, m.hash(key), true).value -= delta
+}
+func (m *BytesMap) Exists(key []byte) bool {
+	return m.find(key, m.hash(key), false) != nil
+}
+func (m *BytesMap) IncludesKey(key []byte) bool {
+	return m.find(key, m.hash(key), false) != nil
+}
+func (m *BytesMap) Delete(key []byte) bool {
+	return m.delete(key, m.hash(key))
+}
+func (m *BytesMap) Len() uint {
+	return m.count
+}
+func (m *BytesMap) DirSize() int {
+	return len(m.dir)
+}
+func (m *BytesMap) BucketCount() int {
+	c := 1
+	for i := 1; i < len(m.dir); i++ {
+		if m.dir[i] != m.dir[i-1] {
+			c++
+		}
+	}
+	return c
+}
+
+// ArenaSize returns number of bytes used to store keys, including garbage left by deleted keys
+func (m *BytesMap) ArenaSize() int {
+	return len(m.arena)
+}
+
+// Do calls f for every entry. Key slice points into the map's arena and must not be modified.
+func (m *BytesMap) Do(f func([]byte, uint)) {
+	di := 0
+	for {
+		b := m.dir[di]
+		for i := 0; i < entriesPerHashBucket; i++ {
+			if b.entries[i].off != 0 {
+				f(m.keyAt(b.entries[i].off), b.entries[i].value)
+			}
+		}
+		for di++; di < len(m.dir) && m.dir[di] == m.dir[di-1]; di++ {
+		}
+		if di == len(m.dir) {
+			return
+		}
+	}
+}
+
+// keyAt returns key stored at arena offset. Capacity is clipped so appends can't overwrite the arena.
+func (m *BytesMap) keyAt(off uint) []byte {
+	l, n := binary.Uvarint(m.arena[off:])
+	start := off + uint(n)
+	end := start + uint(l)
+	return m.arena[start:end:end]
+}
+
+// storeKey appends key to the arena and returns its offset
+func (m *BytesMap) storeKey(key []byte) uint {
+	off := uint(len(m.arena))
+	var lb [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lb[:], uint64(len(key)))
+	m.arena = append(m.arena, lb[:n]...)
+	m.arena = append(m.arena, key...)
+	return off
+}
+
+func (m *BytesMap) storedKeySize(off uint) uint {
+	l, n := binary.Uvarint(m.arena[off:])
+	return uint(n) + uint(l)
+}
+
+// repack moves live keys into new arena, dropping keys of deleted entries
+func (m *BytesMap) repack() {
+	old := m.arena
+	m.arena = make([]byte, 1, uint(len(old))-m.garbage+4096)
+	m.garbage = 0
+	for di := 0; di < len(m.dir); di++ {
+		b := m.dir[di]
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		for i := range b.entries {
+			if off := b.entries[i].off; off != 0 {
+				l, n := binary.Uvarint(old[off:])
+				b.entries[i].off = uint(len(m.arena))
+				m.arena = append(m.arena, old[off:off+uint(n)+uint(l)]...)
+			}
+		}
+	}
+}
+
+func (m *BytesMap) delete(key []byte, h uint) bool {
+	dirIndex := h >> (bitsPerHashCode - m.dirBits)
+	elemIndex := h % entriesPerHashBucket
+	home := elemIndex
+	b := m.dir[dirIndex]
+	for {
+		e := &b.entries[elemIndex]
+		if e.off == 0 {
+			return false
+		}
+		if e.hash == h && bytes.Equal(m.keyAt(e.off), key) {
+			break
+		}
+		elemIndex = (elemIndex + 1) % entriesPerHashBucket
+		if elemIndex == home {
+			return false
+		}
+	}
+	m.garbage += m.storedKeySize(b.entries[elemIndex].off)
+	b.entries[elemIndex] = bmEntry{}
+	lastIndex := elemIndex
+	elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	for elemIndex != lastIndex && b.entries[elemIndex].off != 0 {
+		home = b.entries[elemIndex].hash % entriesPerHashBucket
+		if (lastIndex < elemIndex && (home <= lastIndex || home > elemIndex)) || (lastIndex > elemIndex && home <= lastIndex && home > elemIndex) {
+			b.entries[lastIndex] = b.entries[elemIndex]
+			b.entries[elemIndex] = bmEntry{}
+			lastIndex = elemIndex
+		}
+		elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	}
+	b.count--
+	m.count--
+	if m.garbage > uint(len(m.arena))/2 && len(m.arena) > bmMinRepackSize {
+		m.repack()
+	}
+	return true
+}
+
+func (m *BytesMap) split(h uint) {
+	for {
+		dirIndex := h >> (bitsPerHashCode - m.dirBits)
+		splitBucket := m.dir[dirIndex]
+		if splitBucket.count < entriesPerHashBucket {
+			return // successfully splitted
+		}
+		var diff uint
+		for index := range splitBucket.entries {
+			diff |= splitBucket.entries[index].hash ^ splitBucket.entries[0].hash
+		}
+		if diff == 0 {
+			// no split separates them, the directory would grow until memory runs out
+			panic(HashCollisionError)
+		}
+		newBits := splitBucket.bits + 1
+
+		var workBuckets [2]*bmBucket
+		workBuckets[0] = &bmBucket{bits: newBits}
+		workBuckets[1] = &bmBucket{bits: newBits}
+
+		if m.dirBits == splitBucket.bits {
+			// grow directory
+			newDirSize := len(m.dir) * 2
+			newDir := make([]*bmBucket, newDirSize)
+			for index, b := range m.dir {
+				newDir[2*index] = b
+				newDir[2*index+1] = b
+			}
+			m.dirBits = newBits
+			m.dir = newDir
+			dirIndex *= 2
+		}
+
+		// Copy all elements from split bucket into the new buckets, no rehashing needed
+		for index := 0; index < entriesPerHashBucket; index++ {
+			hash := splitBucket.entries[index].hash
+			sel := (hash >> (bitsPerHashCode - newBits)) & 1
+			bp := workBuckets[sel]
+			elemLoc := hash % entriesPerHashBucket
+			for ; bp.entries[elemLoc].off != 0; elemLoc = (elemLoc + 1) % entriesPerHashBucket {
+			}
+			bp.entries[elemLoc] = splitBucket.entries[index]
+			bp.count++
+		}
+
+		// replace splitBucket with first work bucket
+		var di uint
+		for di = h >> (bitsPerHashCode - m.dirBits); di > 0 && m.dir[di-1] == splitBucket; di-- {
+		}
+		for i, l := di, uint(len(m.dir)); i < l; i++ {
+			if m.dir[i] != splitBucket {
+				break
+			}
+			m.dir[i] = workBuckets[0]
+		}
+
+		// update the directory with second work bucket
+		dirStart := (dirIndex >> (m.dirBits - newBits)) | 1
+		dirEnd := (dirStart + 1) << (m.dirBits - newBits)
+		dirStart = dirStart << (m.dirBits - newBits)
+
+		for index := dirStart; index < dirEnd; index++ {
+			m.dir[index] = workBuckets[1]
+		}
+	}
+}
+
+// find entry for key with hash code h (or add new one). Never allocates on lookup.
+func (m *BytesMap) find(key []byte, h uint, addIfNotExists bool) *bmEntry {
+	dirIndex := h >> (bitsPerHashCode - m.dirBits)
+	elementIndex := h % entriesPerHashBucket
+	b := m.dir[dirIndex]
+	homeIndex := elementIndex
+	for {
+		e := &b.entries[elementIndex]
+		if e.off == 0 {
+			break
+		}
+		if e.hash == h && bytes.Equal(m.keyAt(e.off), key) {
+			return e
+		}
+		elementIndex = (elementIndex + 1) % entriesPerHashBucket
+		if elementIndex == homeIndex {
+			break
+		}
+	}
+	// element not found
+	if !addIfNotExists {
+		return nil
+	}
+	if b.count == entriesPerHashBucket {
+		m.split(h)
+		dirIndex = h >> (bitsPerHashCode - m.dirBits)
+		b = m.dir[dirIndex]
+		elementIndex = h % entriesPerHashBucket
+		for ; b.entries[elementIndex].off != 0; elementIndex = (elementIndex + 1) % entriesPerHashBucket {
+		}
+	}
+	b.count++
+	e := &b.entries[elementIndex]
+	e.hash = h
+	e.off = m.storeKey(key)
+	m.count++
+	return e
+}
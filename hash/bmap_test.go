@@ -0,0 +1,171 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/pi/goal/th"
+	"github.com/stretchr/testify/assert"
+)
+
+func bytesKey(i uint) []byte {
+	return []byte("key-" + strconv.FormatUint(uint64(i), 36))
+}
+
+func Test_BytesMapGetPut(t *testing.T) {
+	const n = 300000
+	m := NewBytesMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(bytesKey(i), i)
+	}
+	assert.EqualValues(t, n, m.Len())
+	for i := uint(0); i < n; i++ {
+		k := bytesKey(i)
+		assert.Equal(t, i, m.Get(k))
+		m.Inc(k, 1)
+		assert.Equal(t, i+1, m.Get(k))
+	}
+	assert.False(t, m.Exists([]byte("absent")))
+	assert.EqualValues(t, 0, m.Get([]byte("absent")))
+
+	// empty and binary keys are ordinary keys
+	m.Put(nil, 5)
+	m.Put([]byte{0, 0, 0}, 7)
+	assert.EqualValues(t, 5, m.Get([]byte{}))
+	assert.EqualValues(t, 7, m.Get([]byte{0, 0, 0}))
+	assert.EqualValues(t, n+2, m.Len())
+}
+
+func Test_BytesMapDelete(t *testing.T) {
+	const n = 200000
+	m := NewBytesMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(bytesKey(i), i)
+	}
+	for i := uint(0); i < n; i += 2 {
+		assert.True(t, m.Delete(bytesKey(i)))
+		assert.False(t, m.Delete(bytesKey(i)))
+	}
+	assert.EqualValues(t, n/2, m.Len())
+	for i := uint(0); i < n; i++ {
+		assert.Equal(t, i&1 == 1, m.IncludesKey(bytesKey(i)))
+	}
+	for i := uint(1); i < n; i += 2 {
+		assert.Equal(t, i, m.Get(bytesKey(i)))
+	}
+	// garbage of deleted keys is eventually dropped
+	size := m.ArenaSize()
+	for round := 0; round < 5; round++ {
+		for i := uint(0); i < n; i += 2 {
+			m.Put(bytesKey(i), i)
+		}
+		for i := uint(0); i < n; i += 2 {
+			m.Delete(bytesKey(i))
+		}
+	}
+	assert.True(t, m.ArenaSize() <= 2*size)
+	for i := uint(1); i < n; i += 2 {
+		assert.Equal(t, i, m.Get(bytesKey(i)))
+	}
+}
+
+func Test_BytesMapIter(t *testing.T) {
+	m := NewBytesMap()
+	keys := make(map[string]uint)
+	for i := uint(0); i < 10000; i++ {
+		keys[string(bytesKey(i))] = i
+		m.Put(bytesKey(i), i)
+	}
+	n := 0
+	for it := m.Iterator(); it.Next(); {
+		n++
+		assert.Equal(t, keys[string(it.CurKey())], it.Cur())
+	}
+	assert.Equal(t, len(keys), n)
+	m.Do(func(k []byte, v uint) {
+		assert.Equal(t, keys[string(k)], v)
+		delete(keys, string(k))
+	})
+	assert.Equal(t, 0, len(keys))
+	assert.True(t, m.BucketCount() > 1)
+}
+
+func Test_BytesMapLookupDoesNotAllocate(t *testing.T) {
+	m := NewBytesMap()
+	for i := uint(0); i < 10000; i++ {
+		m.Put(bytesKey(i), i)
+	}
+	hit := bytesKey(777)
+	miss := []byte("no such key")
+	allocs := testing.AllocsPerRun(1000, func() {
+		m.Get(hit)
+		m.Get(miss)
+		m.Inc(hit, 1)
+	})
+	assert.EqualValues(t, 0, allocs)
+}
+
+func Benchmark_BytesMapInc(b *testing.B) {
+	g := th.NewSeqGen(th.SgRand)
+	g.SetPeriod(100000)
+	m := NewBytesMap()
+	var key [8]byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v := g.Next()
+		for j := range key {
+			key[j] = byte(v >> (8 * uint(j)))
+		}
+		m.Inc(key[:], 1)
+	}
+}
+
+func Benchmark_NativeStringMapInc(b *testing.B) {
+	g := th.NewSeqGen(th.SgRand)
+	g.SetPeriod(100000)
+	m := make(map[string]uint)
+	var key [8]byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v := g.Next()
+		for j := range key {
+			key[j] = byte(v >> (8 * uint(j)))
+		}
+		m[string(key[:])]++
+	}
+}
+
+func Test_BytesMapSeeded(t *testing.T) {
+	const n = 100000
+	m := NewBytesMap(WyHasher{Seed: 1})
+	o := NewBytesMap(WyHasher{Seed: 2})
+	assert.NotEqual(t, m.hash(bytesKey(1)), o.hash(bytesKey(1)))
+	assert.Equal(t, bytesHashCode(bytesKey(1)), NewBytesMap().hash(bytesKey(1)))
+	for i := uint(0); i < n; i++ {
+		m.Put(bytesKey(i), i)
+	}
+	for i := uint(0); i < n; i++ {
+		assert.Equal(t, i, m.Get(bytesKey(i)))
+	}
+	assert.True(t, m.Delete(bytesKey(7)))
+	assert.False(t, m.Exists(bytesKey(7)))
+
+	s := NewStringMap(5, SplitMix64Hasher{Seed: 3})
+	s.Put("a", 1)
+	assert.EqualValues(t, 1, s.Get("a"))
+	assert.Equal(t, 1<<5, s.DirSize())
+	assert.Panics(t, func() { NewBytesMap(OffHeap) })
+	assert.Panics(t, func() { NewStringMap("a") })
+}
+
+func Test_BytesMapHashCollision(t *testing.T) {
+	m := NewBytesMap()
+	// keys sharing the whole hash code can't be split apart
+	for i := uint(0); i < entriesPerHashBucket; i++ {
+		m.find(bytesKey(i), 12345, true).value = i
+	}
+	assert.PanicsWithValue(t, HashCollisionError, func() { m.find(bytesKey(entriesPerHashBucket), 12345, true) })
+	assert.Equal(t, 1<<defaultHashDirBits, m.DirSize())
+	assert.EqualValues(t, entriesPerHashBucket, m.Len())
+	assert.Equal(t, uint(5), m.find(bytesKey(5), 12345, false).value)
+}
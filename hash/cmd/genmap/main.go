@@ -0,0 +1,194 @@
+// Command genmap generates extendible hash maps and sets with integer keys of 32 or 64 bits and
+// values of any type, specialized copies of hash.UintMap and hash.UintSet. They avoid both
+// conversions to uint and boxing of GenericHashMap values. Usage in go:generate directive:
+//
+//	//go:generate go run github.com/pi/goal/hash/cmd/genmap -name Uint32Float64Map -key uint32 -value float64
+//
+// Without -value a set is generated. Maps have the API of UintMap: Get, Put, GetOk, GetOrPut,
+// Swap, CompareAndSwap, Update, batches, iterators, Scan, Stats, snapshots, sorted exports and
+// parallel operations, with Inc, Dec, IncMany, SortedByValue and TopK for numeric values only.
+// Sets have the API of UintSet, set algebra included. Constructors take OffHeap,
+// IncrementalGrowth and, for maps, RobinHood options of the hash package. Off-heap storage
+// needs values without pointers, snapshots need values of fixed size (see encoding/binary).
+// Default hash codes come from hash.UintHashCode, the same as of the hash package containers.
+//
+// Output goes to the file given by -o, by default the lowercased name with _gen.go suffix.
+// With -test a test of the generated container against the builtin map is written next to it,
+// running the cases of the hash package tests under every option.
+// -testvalue gives expression of test value for uint i if the value type is not numeric.
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// container.tmpl includes the other templates, one per file of the hash package features,
+// container_test.tmpl is the test
+//
+//go:embed *.tmpl
+var templates embed.FS
+
+var (
+	// narrower keys are better served by arrays
+	keyTypes     = []string{"int", "int32", "int64", "uint", "uint32", "uint64", "uintptr"}
+	numericTypes = []string{"int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "float32", "float64"}
+)
+
+// params of the templates
+type params struct {
+	Args       string // command line, recorded in generated files
+	Package    string
+	Name       string // container type
+	L          string // prefix of unexported names
+	Q          string // qualifier of hash package names, empty inside the package
+	Key        string
+	Value      string // empty for sets
+	KeyWire    string // fixed size type of keys in snapshots
+	ValueWire  string // type of values in snapshots, fixed size for numeric values
+	Set        bool
+	Numeric    bool // value supports arithmetic
+	Comparable bool // value supports ==
+	BucketSize int
+	TestValue  string // expression of value for uint i used by tests
+
+	Kind, Title, Elements, Arg string // words differing between maps and sets
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// wireType returns 64 bit type for platform dependent integer type t, t itself for others
+func wireType(t string) string {
+	switch t {
+	case "int":
+		return "int64"
+	case "uint", "uintptr":
+		return "uint64"
+	}
+	return t
+}
+
+// parseArgs returns template params and names of output files, the test one is empty without -test
+func parseArgs(args []string) (p params, out, testOut string, err error) {
+	fs := flag.NewFlagSet("genmap", flag.ContinueOnError)
+	fs.StringVar(&p.Name, "name", "", "name of the generated type")
+	fs.StringVar(&p.Key, "key", "", "key type, an integer type of 32 or 64 bits")
+	fs.StringVar(&p.Value, "value", "", "value type, a set is generated if empty")
+	fs.StringVar(&p.Package, "package", os.Getenv("GOPACKAGE"), "package of the generated file")
+	fs.StringVar(&out, "o", "", "output file")
+	fs.IntVar(&p.BucketSize, "bucket", 227, "entries per bucket")
+	fs.BoolVar(&p.Comparable, "comparable", true, "values can be compared with ==, enables CompareAndSwap")
+	test := fs.Bool("test", false, "generate test as well")
+	fs.StringVar(&p.TestValue, "testvalue", "", "test value for uint i, needed for non numeric values")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	switch {
+	case fs.NArg() != 0:
+		err = fmt.Errorf("unexpected arguments %v", fs.Args())
+	case p.Name == "" || !unicode.IsLetter(rune(p.Name[0])):
+		err = errors.New("invalid or missing -name")
+	case !contains(keyTypes, p.Key):
+		err = fmt.Errorf("key type must be one of %v, not %q", keyTypes, p.Key)
+	case p.Package == "":
+		err = errors.New("missing -package outside of go generate")
+	case p.BucketSize < 16:
+		err = errors.New("bucket is too small")
+	}
+	if err != nil {
+		return
+	}
+	p.Args = strings.Join(args, " ")
+	p.L = strings.ToLower(p.Name[:1]) + p.Name[1:]
+	if p.Package != "hash" {
+		p.Q = "hash."
+	}
+	p.Set = p.Value == ""
+	p.Numeric = contains(numericTypes, p.Value)
+	p.KeyWire, p.ValueWire = wireType(p.Key), wireType(p.Value)
+	p.Kind, p.Title, p.Elements, p.Arg = "map", "Map", "entries", "key"
+	if p.Set {
+		p.Kind, p.Title, p.Elements, p.Arg = "set", "Set", "values", "value"
+	}
+	if p.TestValue == "" {
+		if !p.Set && !p.Numeric && *test {
+			err = errors.New("-testvalue is needed for non numeric values")
+			return
+		}
+		p.TestValue = p.Value + "(i)"
+	}
+	if out == "" {
+		out = strings.ToLower(p.Name) + "_gen.go"
+	}
+	if *test {
+		testOut = strings.TrimSuffix(out, ".go") + "_test.go"
+	}
+	return
+}
+
+// generate executes template name with p and formats the result
+func generate(name string, p params) ([]byte, error) {
+	t, err := template.ParseFS(templates, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, p); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not compile: %v", err)
+	}
+	return src, nil
+}
+
+// run generates files for command line args, returning them by name
+func run(args []string) (map[string][]byte, error) {
+	p, out, testOut, err := parseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	if files[out], err = generate("container.tmpl", p); err != nil {
+		return nil, err
+	}
+	if testOut != "" {
+		if files[testOut], err = generate("container_test.tmpl", p); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func main() {
+	files, err := run(os.Args[1:])
+	if err == nil {
+		for name, src := range files {
+			if err = ioutil.WriteFile(name, src, 0666); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "genmap:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_GeneratedUpToDate regenerates files of go:generate directives of the repository
+// and compares them with the checked in ones
+func Test_GeneratedUpToDate(t *testing.T) {
+	defer os.Setenv("GOPACKAGE", os.Getenv("GOPACKAGE"))
+	directives := 0
+	for dir, pkg := range map[string]string{"../..": "hash", "../../internal/genmaptest": "genmaptest"} {
+		os.Setenv("GOPACKAGE", pkg)
+		sources, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		assert.NoError(t, err)
+		for _, source := range sources {
+			data, err := ioutil.ReadFile(source)
+			assert.NoError(t, err)
+			sc := bufio.NewScanner(bytes.NewReader(data))
+			for sc.Scan() {
+				fields := strings.Fields(sc.Text())
+				if len(fields) < 4 || fields[0] != "//go:generate" || !strings.HasSuffix(fields[3], "cmd/genmap") {
+					continue
+				}
+				directives++
+				files, err := run(fields[4:])
+				assert.NoError(t, err)
+				for name, src := range files {
+					current, err := ioutil.ReadFile(filepath.Join(dir, name))
+					assert.NoError(t, err)
+					assert.True(t, bytes.Equal(src, current), "%s is out of date, run go generate", name)
+				}
+			}
+		}
+	}
+	assert.Equal(t, 4, directives)
+}
+
+func Test_InvalidArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"-key", "uint32", "-value", "float64", "-package", "p"},
+		{"-name", "M", "-key", "int8", "-value", "float64", "-package", "p"},
+		{"-name", "M", "-key", "uint32", "-value", "float64"},
+		{"-name", "M", "-key", "uint32", "-value", "Point", "-package", "p", "-test"},
+		{"-name", "M", "-key", "uint32", "-value", "map[", "-package", "p"},
+		{"-name", "M", "-key", "uint32", "-package", "p", "extra"},
+		{"-name", "M", "-key", "uint32", "-package", "p", "-bucket", "3"},
+	} {
+		os.Setenv("GOPACKAGE", "")
+		_, err := run(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func Test_Output(t *testing.T) {
+	files, err := run([]string{"-name", "IntSet", "-key", "int", "-package", "p", "-o", "set.go", "-test"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+	assert.Contains(t, string(files["set.go"]), "func (m *IntSet) Add(value int)")
+	assert.Contains(t, string(files["set.go"]), "panic(hash.ConcurrentModificationError)")
+	assert.Contains(t, string(files["set.go"]), "func (m *IntSet) SymmetricDifference(o *IntSet) *IntSet")
+	assert.Contains(t, string(files["set.go"]), "func (m *IntSet) ParallelSelect(")
+	assert.Contains(t, string(files["set_test.go"]), "func Test_IntSetIterator(")
+	assert.Contains(t, string(files["set_test.go"]), "func Test_IntSetAlgebra(")
+
+	files, err = run([]string{"-name", "M", "-key", "uint", "-value", "[]byte", "-package", "hash", "-comparable=false"})
+	assert.NoError(t, err)
+	src := string(files["m_gen.go"])
+	assert.NotContains(t, src, "CompareAndSwap")
+	assert.NotContains(t, src, "Inc(")
+	assert.NotContains(t, src, "hash.")
+	assert.NotContains(t, src, "TopK(")
+	assert.NotContains(t, src, "Histogram()")
+	for _, f := range []string{"SortedByKey", "Scan", "Stats", "WriteTo", "ParallelReduce", "Free"} {
+		assert.Contains(t, src, "func (m *M) "+f+"(")
+	}
+}
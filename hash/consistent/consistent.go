@@ -0,0 +1,208 @@
+// Package consistent routes uint keys to members (shards) so that changing the member set
+// moves few keys: about 1/n of them when the n-th member is added, and only keys of the
+// removed member when one is removed. Modulo routing moves almost all keys instead.
+//
+// Three schemes are provided:
+//
+//	Jump        Jump Consistent Hash of Lamping and Veach: no memory, perfectly balanced, but
+//	            members are numbered 0..n-1 and only the last one can be removed.
+//	Rendezvous  highest random weight hashing: any member can be added or removed,
+//	            weights are exact, lookup costs O(n) hashes.
+//	Ring        ring of virtual nodes: any member can be added or removed, lookup is
+//	            a binary search, balance and weights are approximate, within a few percents
+//	            at the default 160 virtual nodes per unit of weight.
+//
+// Lookups do not allocate. Rendezvous and Ring are not safe for concurrent modification.
+package consistent
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pi/goal/hash"
+)
+
+// Jump returns bucket of key in [0, buckets)
+func Jump(key uint, buckets int) int {
+	if buckets < 1 {
+		panic("no buckets")
+	}
+	k := uint64(key)
+	b, j := int64(-1), int64(0)
+	for j < int64(buckets) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// Rendezvous
+
+type rendezvousMember struct {
+	id     uint
+	weight float64
+}
+
+// Rendezvous assigns key to the member with the highest score -weight/ln(h), where h is
+// a hash of key and member id mapped to (0, 1)
+type Rendezvous struct {
+	members []rendezvousMember
+}
+
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{}
+}
+
+func (r *Rendezvous) find(id uint) int {
+	for i := range r.members {
+		if r.members[i].id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add adds member id with positive weight or changes weight of existing member
+func (r *Rendezvous) Add(id uint, weight float64) {
+	if !(weight > 0) {
+		panic("invalid weight")
+	}
+	if i := r.find(id); i >= 0 {
+		r.members[i].weight = weight
+		return
+	}
+	r.members = append(r.members, rendezvousMember{id, weight})
+}
+
+// Remove removes member id, returns false if there was no such member
+func (r *Rendezvous) Remove(id uint) bool {
+	i := r.find(id)
+	if i < 0 {
+		return false
+	}
+	r.members = append(r.members[:i], r.members[i+1:]...)
+	return true
+}
+
+// Len returns number of members
+func (r *Rendezvous) Len() int {
+	return len(r.members)
+}
+
+// Get returns member of key
+func (r *Rendezvous) Get(key uint) uint {
+	if len(r.members) == 0 {
+		panic("no members")
+	}
+	best, bestScore := uint(0), math.Inf(-1)
+	for _, m := range r.members {
+		h := hash.WyHasher{Seed: m.id}.Hash(key)
+		// top 53 bits to (0, 1)
+		u := (float64(h>>11) + 0.5) / (1 << 53)
+		if score := -m.weight / math.Log(u); score > bestScore || (score == bestScore && m.id < best) {
+			best, bestScore = m.id, score
+		}
+	}
+	return best
+}
+
+// Ring
+
+// DefaultReplicas is number of virtual nodes per unit of weight
+const DefaultReplicas = 160
+
+// ringSeed seeds hashes of keys, virtual nodes are seeded by member ids
+const ringSeed = 0x9e3779b97f4a7c15
+
+type ringPoint struct {
+	hash uint
+	id   uint
+}
+
+// Ring places round(replicas*weight) virtual nodes of every member on a circle of hash codes,
+// key belongs to the member of the first node at or after hash of the key
+type Ring struct {
+	points   []ringPoint // sorted by hash, then id
+	weights  map[uint]float64
+	replicas int
+}
+
+// NewRing creates ring with optional number of virtual nodes per unit of weight
+func NewRing(replicas ...int) *Ring {
+	r := &Ring{weights: make(map[uint]float64), replicas: DefaultReplicas}
+	switch len(replicas) {
+	case 0:
+	case 1:
+		if replicas[0] < 1 {
+			panic("invalid number of replicas")
+		}
+		r.replicas = replicas[0]
+	default:
+		panic("usage: NewRing([replicas])")
+	}
+	return r
+}
+
+// Add adds member id with positive weight or changes weight of existing member
+func (r *Ring) Add(id uint, weight float64) {
+	if !(weight > 0) {
+		panic("invalid weight")
+	}
+	r.Remove(id)
+	n := int(math.Round(weight * float64(r.replicas)))
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		r.points = append(r.points, ringPoint{hash.WyHasher{Seed: id}.Hash(uint(i)), id})
+	}
+	r.weights[id] = weight
+	sort.Slice(r.points, func(i, j int) bool {
+		a, b := r.points[i], r.points[j]
+		return a.hash < b.hash || (a.hash == b.hash && a.id < b.id)
+	})
+}
+
+// Remove removes member id, returns false if there was no such member
+func (r *Ring) Remove(id uint) bool {
+	if _, ok := r.weights[id]; !ok {
+		return false
+	}
+	delete(r.weights, id)
+	n := 0
+	for _, p := range r.points {
+		if p.id != id {
+			r.points[n] = p
+			n++
+		}
+	}
+	r.points = r.points[:n]
+	return true
+}
+
+// Len returns number of members
+func (r *Ring) Len() int {
+	return len(r.weights)
+}
+
+// Get returns member of key
+func (r *Ring) Get(key uint) uint {
+	if len(r.points) == 0 {
+		panic("no members")
+	}
+	h := hash.WyHasher{Seed: ringSeed}.Hash(key)
+	lo, hi := 0, len(r.points)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if r.points[mid].hash < h {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == len(r.points) {
+		lo = 0
+	}
+	return r.points[lo].id
+}
@@ -0,0 +1,207 @@
+package consistent
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKeys = 100000
+
+// moved returns fraction of keys routed differently by before and after
+func moved(before, after func(key uint) uint) float64 {
+	n := 0
+	for k := uint(0); k < testKeys; k++ {
+		if before(k) != after(k) {
+			n++
+		}
+	}
+	return float64(n) / testKeys
+}
+
+// route returns routing of all test keys
+func route(get func(key uint) uint) []uint {
+	r := make([]uint, testKeys)
+	for k := range r {
+		r[k] = get(uint(k))
+	}
+	return r
+}
+
+// assertBalance checks that every member gets its share of keys within tolerance
+func assertBalance(t *testing.T, routes []uint, shares map[uint]float64, tolerance float64) {
+	counts := make(map[uint]int)
+	for _, m := range routes {
+		counts[m]++
+	}
+	assert.Len(t, counts, len(shares))
+	for m, share := range shares {
+		got := float64(counts[m]) / float64(len(routes))
+		assert.True(t, math.Abs(got-share) < share*tolerance, "member %d: %v, expected %v", m, got, share)
+	}
+}
+
+func Test_ModuloMovement(t *testing.T) {
+	// baseline: modulo routing moves almost everything
+	m := moved(func(k uint) uint { return k * 0x9e3779b97f4a7c15 % 10 }, func(k uint) uint { return k * 0x9e3779b97f4a7c15 % 11 })
+	t.Logf("modulo 10 -> 11 moved %.3f", m)
+	assert.True(t, m > 0.8)
+}
+
+func Test_Jump(t *testing.T) {
+	for _, n := range []int{1, 10, 100} {
+		before := route(func(k uint) uint { return uint(Jump(k, n)) })
+		after := route(func(k uint) uint { return uint(Jump(k, n+1)) })
+		changed := 0
+		for k := range before {
+			if before[k] != after[k] {
+				changed++
+				// keys move to the new bucket only
+				assert.Equal(t, uint(n), after[k])
+			}
+		}
+		m := float64(changed) / testKeys
+		t.Logf("jump %d -> %d moved %.4f", n, n+1, m)
+		assert.True(t, math.Abs(m-1/float64(n+1)) < 0.1/float64(n+1))
+		shares := make(map[uint]float64)
+		for i := 0; i <= n; i++ {
+			shares[uint(i)] = 1 / float64(n+1)
+		}
+		assertBalance(t, after, shares, 0.2)
+	}
+	assert.Panics(t, func() { Jump(1, 0) })
+}
+
+func Test_Rendezvous(t *testing.T) {
+	r := NewRendezvous()
+	shares := make(map[uint]float64)
+	for id := uint(1); id <= 10; id++ {
+		r.Add(id*1000, 1)
+		shares[id*1000] = 0.1
+	}
+	before := route(r.Get)
+	assertBalance(t, before, shares, 0.1)
+
+	r.Add(77, 1)
+	after := route(r.Get)
+	changed := 0
+	for k := range before {
+		if before[k] != after[k] {
+			changed++
+			assert.Equal(t, uint(77), after[k])
+		}
+	}
+	m := float64(changed) / testKeys
+	t.Logf("rendezvous 10 -> 11 moved %.4f", m)
+	assert.True(t, math.Abs(m-1.0/11) < 0.01)
+
+	// removal moves only keys of the removed member
+	assert.True(t, r.Remove(3000))
+	assert.False(t, r.Remove(3000))
+	removed := route(r.Get)
+	for k := range after {
+		if after[k] != 3000 {
+			assert.Equal(t, after[k], removed[k])
+		}
+	}
+
+	// weights are exact
+	w := NewRendezvous()
+	w.Add(1, 1)
+	w.Add(2, 2)
+	w.Add(3, 1)
+	assertBalance(t, route(w.Get), map[uint]float64{1: 0.25, 2: 0.5, 3: 0.25}, 0.05)
+	w.Add(2, 1)
+	assert.Equal(t, 3, w.Len())
+	assertBalance(t, route(w.Get), map[uint]float64{1: 1.0 / 3, 2: 1.0 / 3, 3: 1.0 / 3}, 0.05)
+	assert.Panics(t, func() { NewRendezvous().Get(1) })
+	assert.Panics(t, func() { w.Add(4, 0) })
+}
+
+func Test_Ring(t *testing.T) {
+	r := NewRing()
+	shares := make(map[uint]float64)
+	for id := uint(1); id <= 10; id++ {
+		r.Add(id, 1)
+		shares[id] = 0.1
+	}
+	before := route(r.Get)
+	assertBalance(t, before, shares, 0.2)
+
+	r.Add(11, 1)
+	after := route(r.Get)
+	changed := 0
+	for k := range before {
+		if before[k] != after[k] {
+			changed++
+			assert.Equal(t, uint(11), after[k])
+		}
+	}
+	m := float64(changed) / testKeys
+	t.Logf("ring 10 -> 11 moved %.4f", m)
+	assert.True(t, math.Abs(m-1.0/11) < 0.03)
+
+	assert.True(t, r.Remove(4))
+	assert.False(t, r.Remove(4))
+	assert.Equal(t, 10, r.Len())
+	removed := route(r.Get)
+	for k := range after {
+		if after[k] != 4 {
+			assert.Equal(t, after[k], removed[k])
+		}
+	}
+	// removing the added member restores the original routing
+	r.Add(4, 1)
+	r.Remove(11)
+	assert.Equal(t, before, route(r.Get))
+
+	w := NewRing(500)
+	w.Add(1, 1)
+	w.Add(2, 3)
+	assertBalance(t, route(w.Get), map[uint]float64{1: 0.25, 2: 0.75}, 0.1)
+	assert.Panics(t, func() { NewRing(0) })
+	assert.Panics(t, func() { NewRing().Get(1) })
+}
+
+func Test_LookupAllocs(t *testing.T) {
+	r, g := NewRendezvous(), NewRing()
+	for id := uint(0); id < 20; id++ {
+		r.Add(id, 1)
+		g.Add(id, 1)
+	}
+	key := uint(0)
+	assert.Zero(t, testing.AllocsPerRun(1000, func() { key += uint(Jump(key, 20)) + 1 }))
+	assert.Zero(t, testing.AllocsPerRun(1000, func() { key += r.Get(key) + 1 }))
+	assert.Zero(t, testing.AllocsPerRun(1000, func() { key += g.Get(key) + 1 }))
+}
+
+var sink uint
+
+func Benchmark_Jump(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink += uint(Jump(uint(i), 100))
+	}
+}
+
+func Benchmark_Rendezvous(b *testing.B) {
+	r := NewRendezvous()
+	for id := uint(0); id < 100; id++ {
+		r.Add(id, 1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sink += r.Get(uint(i))
+	}
+}
+
+func Benchmark_Ring(b *testing.B) {
+	r := NewRing()
+	for id := uint(0); id < 100; id++ {
+		r.Add(id, 1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sink += r.Get(uint(i))
+	}
+}
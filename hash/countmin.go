@@ -0,0 +1,185 @@
+package hash
+
+//
+// Count-Min sketch: approximate counters of a key stream in fixed memory.
+//
+// Sketch of width w and depth d keeps d rows of w counters, every key increments one counter
+// per row and its estimate is the minimum of them. Estimates never undercount; with probability
+// 1-e^-d the overcount is at most e/w of the total count (Cormode, Muthukrishnan).
+// NewCountMinSketchForError picks w and d for error epsilon*total with probability 1-delta.
+//
+// Conservative update (ConservativeUpdate option) raises only the counters below the new
+// estimate. It keeps the guarantees and reduces the overcount substantially on skewed streams,
+// at the cost of a lookup per Add.
+//
+// Row positions come from double hashing as in BloomFilter. Sketches with the same width
+// and depth can be merged, the result is a sketch of both streams.
+//
+
+// prefix: cms
+
+import "math"
+
+type conservativeOption struct{}
+
+// ConservativeUpdate passed to NewCountMinSketch enables conservative update
+var ConservativeUpdate conservativeOption
+
+var countMinSketchMagic = [4]byte{'G', 'C', 'M', 'S'}
+
+type CountMinSketch struct {
+	counters     []uint // depth rows of width counters
+	width        uint
+	depth        uint
+	total        uint
+	conservative bool
+}
+
+// NewCountMinSketch creates sketch with depth rows of width counters, args may be ConservativeUpdate
+func NewCountMinSketch(width, depth uint, args ...interface{}) *CountMinSketch {
+	const usage = "usage: NewCountMinSketch(width, depth, [ConservativeUpdate])"
+	if width == 0 || depth == 0 {
+		panic(usage)
+	}
+	s := &CountMinSketch{counters: make([]uint, width*depth), width: width, depth: depth}
+	for _, arg := range args {
+		if _, ok := arg.(conservativeOption); !ok || s.conservative {
+			panic(usage)
+		}
+		s.conservative = true
+	}
+	return s
+}
+
+// NewCountMinSketchForError creates sketch overcounting by at most epsilon*Total()
+// with probability 1-delta
+func NewCountMinSketchForError(epsilon, delta float64, args ...interface{}) *CountMinSketch {
+	if !(epsilon > 0 && epsilon < 1) || !(delta > 0 && delta < 1) {
+		panic("invalid error bounds")
+	}
+	width := uint(math.Ceil(math.E / epsilon))
+	depth := uint(math.Ceil(math.Log(1 / delta)))
+	return NewCountMinSketch(width, depth, args...)
+}
+
+func (s *CountMinSketch) add(h, count uint) {
+	s.total += count
+	h1, h2 := bloomHashes(h)
+	if !s.conservative {
+		for row := uint(0); row < s.depth; row++ {
+			s.counters[row*s.width+bloomRange(h1, s.width)] += count
+			h1 += h2
+		}
+		return
+	}
+	target := s.estimate(h) + count
+	for row := uint(0); row < s.depth; row++ {
+		if c := &s.counters[row*s.width+bloomRange(h1, s.width)]; *c < target {
+			*c = target
+		}
+		h1 += h2
+	}
+}
+
+func (s *CountMinSketch) estimate(h uint) uint {
+	h1, h2 := bloomHashes(h)
+	min := ^uint(0)
+	for row := uint(0); row < s.depth; row++ {
+		if c := s.counters[row*s.width+bloomRange(h1, s.width)]; c < min {
+			min = c
+		}
+		h1 += h2
+	}
+	return min
+}
+
+// Add adds count occurrences of key
+func (s *CountMinSketch) Add(key, count uint) {
+	s.add(uintHashCode(key), count)
+}
+
+func (s *CountMinSketch) AddBytes(key []byte, count uint) {
+	s.add(bytesHashCode(key), count)
+}
+
+// Estimate returns estimated count of key, never less than the real one
+func (s *CountMinSketch) Estimate(key uint) uint {
+	return s.estimate(uintHashCode(key))
+}
+
+func (s *CountMinSketch) EstimateBytes(key []byte) uint {
+	return s.estimate(bytesHashCode(key))
+}
+
+// Total returns sum of all counts added
+func (s *CountMinSketch) Total() uint {
+	return s.total
+}
+
+func (s *CountMinSketch) Width() uint {
+	return s.width
+}
+
+func (s *CountMinSketch) Depth() uint {
+	return s.depth
+}
+
+// ErrorBound returns overcount which an estimate exceeds with probability 1-Confidence() at most
+func (s *CountMinSketch) ErrorBound() uint {
+	return uint(math.Ceil(math.E / float64(s.width) * float64(s.total)))
+}
+
+// Confidence returns probability of an estimate being within ErrorBound
+func (s *CountMinSketch) Confidence() float64 {
+	return 1 - math.Exp(-float64(s.depth))
+}
+
+// Merge adds counts of o to s. Sketches must have the same width and depth.
+func (s *CountMinSketch) Merge(o *CountMinSketch) error {
+	if s.width != o.width || s.depth != o.depth {
+		return SketchMismatchError
+	}
+	for i, c := range o.counters {
+		s.counters[i] += c
+	}
+	s.total += o.total
+	return nil
+}
+
+func (s *CountMinSketch) Clear() {
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+	s.total = 0
+}
+
+func (s *CountMinSketch) MarshalBinary() ([]byte, error) {
+	var conservative uint64
+	if s.conservative {
+		conservative = 1
+	}
+	data := make([]uint64, len(s.counters))
+	for i, c := range s.counters {
+		data[i] = uint64(c)
+	}
+	return sketchEncode(countMinSketchMagic,
+		[]uint64{uint64(s.width), uint64(s.depth), uint64(s.total), conservative}, data), nil
+}
+
+func (s *CountMinSketch) UnmarshalBinary(data []byte) error {
+	params, counters, err := sketchDecode(data, countMinSketchMagic, 4)
+	if err != nil {
+		return err
+	}
+	width, depth := params[0], params[1]
+	if width == 0 || depth == 0 || uint64(len(counters))/width != depth || uint64(len(counters))%width != 0 || params[3] > 1 {
+		return SnapshotFormatError
+	}
+	t := CountMinSketch{counters: make([]uint, len(counters)), width: uint(width), depth: uint(depth),
+		total: uint(params[2]), conservative: params[3] == 1}
+	for i, c := range counters {
+		t.counters[i] = uint(c)
+	}
+	*s = t
+	return nil
+}
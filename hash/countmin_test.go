@@ -0,0 +1,80 @@
+package hash
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zipfStream returns n keys of Zipf distribution and their real counts
+func zipfStream(n int, seed int64) ([]uint, map[uint]uint) {
+	z := rand.NewZipf(rand.New(rand.NewSource(seed)), 1.1, 1, 1<<20)
+	keys := make([]uint, n)
+	counts := make(map[uint]uint)
+	for i := range keys {
+		keys[i] = uint(z.Uint64())
+		counts[keys[i]]++
+	}
+	return keys, counts
+}
+
+func Test_CountMinSketch(t *testing.T) {
+	keys, counts := zipfStream(500000, 1)
+	s := NewCountMinSketchForError(0.001, 0.01)
+	c := NewCountMinSketchForError(0.001, 0.01, ConservativeUpdate)
+	assert.EqualValues(t, 2719, s.Width())
+	assert.EqualValues(t, 5, s.Depth())
+	for _, k := range keys {
+		s.Add(k, 1)
+		c.Add(k, 1)
+	}
+	assert.EqualValues(t, len(keys), s.Total())
+	bound := s.ErrorBound()
+	assert.EqualValues(t, 500, bound)
+	over, sumErr, sumErrC := 0, uint(0), uint(0)
+	for k, n := range counts {
+		e, ec := s.Estimate(k), c.Estimate(k)
+		if e < n || ec < n {
+			t.Fatalf("undercount of %d: %d %d < %d", k, e, ec, n)
+		}
+		assert.True(t, ec <= e)
+		if e-n > bound {
+			over++
+		}
+		sumErr += e - n
+		sumErrC += ec - n
+	}
+	assert.True(t, float64(over) < (1-s.Confidence())*float64(len(counts)))
+	assert.True(t, sumErrC < sumErr*3/4, "conservative %d, standard %d", sumErrC, sumErr)
+	assert.Panics(t, func() { NewCountMinSketch(0, 1) })
+	assert.Panics(t, func() { NewCountMinSketch(1, 1, 5) })
+}
+
+func Test_CountMinSketchMerge(t *testing.T) {
+	keys, _ := zipfStream(100000, 2)
+	all, a, b := NewCountMinSketch(1000, 4), NewCountMinSketch(1000, 4), NewCountMinSketch(1000, 4)
+	for i, k := range keys {
+		all.Add(k, 2)
+		if i%2 == 0 {
+			a.Add(k, 2)
+		} else {
+			b.Add(k, 2)
+		}
+	}
+	assert.NoError(t, a.Merge(b))
+	assert.Equal(t, all.counters, a.counters)
+	assert.Equal(t, all.Total(), a.Total())
+	assert.Equal(t, SketchMismatchError, a.Merge(NewCountMinSketch(1000, 3)))
+
+	a.AddBytes([]byte("abc"), 7)
+	assert.True(t, a.EstimateBytes([]byte("abc")) >= 7)
+	data, err := a.MarshalBinary()
+	assert.NoError(t, err)
+	var r CountMinSketch
+	assert.NoError(t, r.UnmarshalBinary(data))
+	assert.Equal(t, a.counters, r.counters)
+	assert.Equal(t, a.Total(), r.Total())
+	a.Clear()
+	assert.EqualValues(t, 0, a.Estimate(keys[0]))
+}
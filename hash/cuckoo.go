@@ -0,0 +1,218 @@
+package hash
+
+//
+// Cuckoo filter: approximate set membership with deletion.
+//
+// Every key is reduced to a 16-bit fingerprint stored in one of two candidate buckets of
+// 4 slots. A bucket is one uint64 and is searched for a fingerprint without a loop.
+// Partial-key cuckoo hashing computes the alternate bucket from the current one and the
+// fingerprint only, i2 = i1 ^ hash(fp), so fingerprints can be moved without their keys.
+// Number of buckets is a power of two for the xor to stay in range.
+//
+// Hash code of a key comes from the optional Hasher (uintHashCode by default) as in the
+// containers, followed by mix64: fingerprint is taken from top bits and bucket from bottom ones.
+//
+// When a fingerprint can't be placed after cuckooMaxKicks evictions it is kept aside as victim
+// and the filter is full: further Adds fail until a Delete makes room. Nothing added is lost,
+// so there are no false negatives. Deleting a key which was not added may delete a key
+// sharing its fingerprint and bucket.
+//
+// False positive rate is about 8*LoadFactor/2^16, 1.2e-4 at the full load of ~95%.
+//
+
+// prefix: cuckoo
+
+import "math"
+
+const (
+	cuckooSlots    = 4
+	cuckooMaxKicks = 500
+	cuckooMaxLoad  = 0.95 // achievable load, used for sizing
+	cuckooOnes     = 0x0001000100010001
+	cuckooHighs    = 0x8000800080008000
+)
+
+type CuckooFilter struct {
+	buckets     []uint64 // 4 fingerprints of 16 bits, 0 is empty slot
+	mask        uint
+	count       uint
+	hasher      Hasher
+	rnd         uint // xorshift state for eviction choices
+	victim      uint // fingerprint which found no place, 0 if none
+	victimIndex uint
+}
+
+// NewCuckooFilter creates filter for capacity keys with optional hasher
+func NewCuckooFilter(capacity uint, args ...interface{}) *CuckooFilter {
+	const usage = "usage: NewCuckooFilter(capacity, [hasher])"
+	o := parseContainerOptions(args, usage)
+	o.plainOnly(usage)
+	if o.bitsSet {
+		panic(usage)
+	}
+	n := uint(1)
+	for float64(capacity) > float64(n*cuckooSlots)*cuckooMaxLoad {
+		n *= 2
+	}
+	return &CuckooFilter{
+		buckets: make([]uint64, n),
+		mask:    n - 1,
+		hasher:  o.hasher,
+		rnd:     bytesHashPrime1,
+	}
+}
+
+// locate returns fingerprint and first bucket of key
+func (f *CuckooFilter) locate(key uint) (fp, i uint) {
+	var h uint
+	if f.hasher == nil {
+		h = uintHashCode(key)
+	} else {
+		h = f.hasher.Hash(key)
+	}
+	h = mix64(h)
+	fp = h >> 48
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, h & f.mask
+}
+
+// alt returns the other bucket of fingerprint fp stored in bucket i
+func (f *CuckooFilter) alt(i, fp uint) uint {
+	return (i ^ mix64(fp)) & f.mask
+}
+
+// has reports whether bucket i holds fingerprint fp
+func (f *CuckooFilter) has(i, fp uint) bool {
+	x := f.buckets[i] ^ uint64(fp)*cuckooOnes
+	return (x-cuckooOnes)&^x&cuckooHighs != 0
+}
+
+// insert stores fp into a free slot of bucket i
+func (f *CuckooFilter) insert(i, fp uint) bool {
+	b := f.buckets[i]
+	for s := uint(0); s < cuckooSlots; s++ {
+		if b>>(16*s)&0xffff == 0 {
+			f.buckets[i] = b | uint64(fp)<<(16*s)
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes one copy of fp from bucket i
+func (f *CuckooFilter) remove(i, fp uint) bool {
+	b := f.buckets[i]
+	for s := uint(0); s < cuckooSlots; s++ {
+		if uint(b>>(16*s))&0xffff == fp {
+			f.buckets[i] = b &^ (0xffff << (16 * s))
+			return true
+		}
+	}
+	return false
+}
+
+func (f *CuckooFilter) random() uint {
+	f.rnd ^= f.rnd << 13
+	f.rnd ^= f.rnd >> 7
+	f.rnd ^= f.rnd << 17
+	return f.rnd
+}
+
+// place stores fp into bucket i or its alternate, evicting other fingerprints if needed.
+// Fingerprint left without place becomes the victim.
+func (f *CuckooFilter) place(i, fp uint) {
+	if f.insert(i, fp) {
+		return
+	}
+	i = f.alt(i, fp)
+	if f.insert(i, fp) {
+		return
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		if f.random()&1 == 0 {
+			i = f.alt(i, fp)
+		}
+		shift := 16 * (f.random() % cuckooSlots)
+		old := uint(f.buckets[i]>>shift) & 0xffff
+		f.buckets[i] = f.buckets[i]&^(0xffff<<shift) | uint64(fp)<<shift
+		fp = old
+		i = f.alt(i, fp)
+		if f.insert(i, fp) {
+			return
+		}
+	}
+	f.victim, f.victimIndex = fp, i
+}
+
+// Add adds key, adding a key several times needs several Deletes to remove it.
+// Returns false if the filter is full, the key is not added then.
+func (f *CuckooFilter) Add(key uint) bool {
+	if f.victim != 0 {
+		return false
+	}
+	fp, i := f.locate(key)
+	f.place(i, fp)
+	f.count++
+	return true
+}
+
+// Contains reports whether key may have been added. False means it certainly was not.
+func (f *CuckooFilter) Contains(key uint) bool {
+	fp, i1 := f.locate(key)
+	i2 := f.alt(i1, fp)
+	return f.has(i1, fp) || f.has(i2, fp) ||
+		(f.victim == fp && (f.victimIndex == i1 || f.victimIndex == i2))
+}
+
+// Delete deletes one copy of key added before, returns false if the key was not found
+func (f *CuckooFilter) Delete(key uint) bool {
+	fp, i1 := f.locate(key)
+	i2 := f.alt(i1, fp)
+	switch {
+	case f.remove(i1, fp) || f.remove(i2, fp):
+		if f.victim != 0 {
+			// the room made by deletion may fit the victim
+			fp, i := f.victim, f.victimIndex
+			f.victim = 0
+			f.place(i, fp)
+		}
+	case f.victim == fp && (f.victimIndex == i1 || f.victimIndex == i2):
+		f.victim = 0
+	default:
+		return false
+	}
+	f.count--
+	return true
+}
+
+// Count returns number of keys in the filter
+func (f *CuckooFilter) Count() uint {
+	return f.count
+}
+
+// Capacity returns number of fingerprint slots
+func (f *CuckooFilter) Capacity() uint {
+	return uint(len(f.buckets)) * cuckooSlots
+}
+
+// LoadFactor returns fraction of occupied slots
+func (f *CuckooFilter) LoadFactor() float64 {
+	return float64(f.count) / float64(f.Capacity())
+}
+
+// EstimatedFalsePositiveRate returns theoretical false positive rate at the current load:
+// a lookup compares 2*cuckooSlots*LoadFactor fingerprints on average, each matching with
+// probability 1/(2^16-1). It is computed, not measured, and assumes uniform fingerprints.
+func (f *CuckooFilter) EstimatedFalsePositiveRate() float64 {
+	return 1 - math.Pow(1-1.0/(1<<16-1), 2*cuckooSlots*f.LoadFactor())
+}
+
+func (f *CuckooFilter) Clear() {
+	for i := range f.buckets {
+		f.buckets[i] = 0
+	}
+	f.count = 0
+	f.victim = 0
+}
@@ -0,0 +1,90 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CuckooFilter(t *testing.T) {
+	const n = 100000
+	f := NewCuckooFilter(n)
+	assert.True(t, f.Capacity() >= n)
+	for i := uint(0); i < n; i++ {
+		assert.True(t, f.Add(i))
+	}
+	assert.EqualValues(t, n, f.Count())
+	for i := uint(0); i < n; i++ {
+		if !f.Contains(i) {
+			t.Fatalf("false negative %d", i)
+		}
+	}
+	fp := 0
+	const probes = 1000000
+	for i := uint(n); i < n+probes; i++ {
+		if f.Contains(i) {
+			fp++
+		}
+	}
+	rate := float64(fp) / probes
+	// documented rate at full load, 8 fingerprints compared by a lookup
+	assert.True(t, rate < 1.2e-4, "rate %v", rate)
+	assert.True(t, f.EstimatedFalsePositiveRate() < 1.2e-4)
+
+	for i := uint(0); i < n; i += 2 {
+		assert.True(t, f.Delete(i))
+	}
+	assert.EqualValues(t, n/2, f.Count())
+	for i := uint(1); i < n; i += 2 {
+		assert.True(t, f.Contains(i))
+	}
+	for i := uint(1); i < n; i += 2 {
+		assert.True(t, f.Delete(i))
+	}
+	assert.EqualValues(t, 0, f.Count())
+	assert.False(t, f.Delete(1))
+	for _, b := range f.buckets {
+		assert.Equal(t, uint64(0), b)
+	}
+}
+
+func Test_CuckooFilterFull(t *testing.T) {
+	f := NewCuckooFilter(10000, NewRandomHasher())
+	var added uint
+	for f.Add(added) {
+		added++
+	}
+	assert.Equal(t, added, f.Count())
+	assert.True(t, f.LoadFactor() > 0.9, "load %v", f.LoadFactor())
+	assert.NotEqual(t, uint(0), f.victim)
+	for i := uint(0); i < added; i++ {
+		if !f.Contains(i) {
+			t.Fatalf("false negative %d", i)
+		}
+	}
+	// deletion makes room for the victim and for new keys
+	assert.True(t, f.Delete(0))
+	for i := uint(1); i < added; i++ {
+		if !f.Contains(i) {
+			t.Fatalf("false negative %d after delete", i)
+		}
+	}
+	if f.victim == 0 {
+		assert.True(t, f.Add(0))
+	}
+	f.Clear()
+	assert.EqualValues(t, 0, f.Count())
+	assert.True(t, f.Add(5))
+	assert.True(t, f.Contains(5))
+}
+
+func Test_CuckooFilterDuplicates(t *testing.T) {
+	f := NewCuckooFilter(100)
+	f.Add(7)
+	f.Add(7)
+	assert.True(t, f.Delete(7))
+	assert.True(t, f.Contains(7))
+	assert.True(t, f.Delete(7))
+	assert.False(t, f.Contains(7))
+	assert.Panics(t, func() { NewCuckooFilter(100, 10) })
+}
@@ -0,0 +1,181 @@
+package hash
+
+//
+// ConcurrentUintMap
+// uint->uint map safe for concurrent use.
+// Keys are split into independently locked shards by the top bits of their hash code,
+// each shard is a separate extendible hashing directory indexed by the remaining bits.
+//
+
+// prefix: cum
+
+import (
+	"runtime"
+	"sync"
+)
+
+const maxShardBits = 16
+
+type cumShard struct {
+	sync.RWMutex
+	m UintMap
+	_ [64]byte // keep hot shard headers on separate cache lines
+}
+
+type ConcurrentUintMap struct {
+	shardBits uint
+	shards    []cumShard
+	hasher    Hasher
+}
+
+// NewConcurrentUintMap creates map with 2^shardBits shards. Optional arguments are shard bits and Hasher.
+// By default number of shards is derived from the number of CPUs.
+func NewConcurrentUintMap(args ...interface{}) *ConcurrentUintMap {
+	o := parseContainerOptions(args, "usage: NewConcurrentUintMap([shardBits], [hasher])")
+	o.plainOnly("usage: NewConcurrentUintMap([shardBits], [hasher])")
+	m := &ConcurrentUintMap{hasher: o.hasher}
+	m.shardBits = o.shardBitsOption()
+	m.shards = make([]cumShard, 1<<m.shardBits)
+	for i := range m.shards {
+		m.shards[i].m.hasher = o.hasher
+		m.shards[i].m.hashShift = m.shardBits
+		m.shards[i].m.init(defaultHashDirBits)
+	}
+	return m
+}
+
+// shardBitsOption returns shard bits from options or default for the current machine
+func (o *containerOptions) shardBitsOption() uint {
+	if !o.bitsSet {
+		bits := uint(0)
+		for (1 << bits) < 4*runtime.NumCPU() {
+			bits++
+		}
+		return bits
+	}
+	if o.bits > maxShardBits {
+		panic("invalid shard bits")
+	}
+	return o.bits
+}
+
+func (m *ConcurrentUintMap) shard(key uint) *cumShard {
+	var h uint
+	if m.hasher == nil {
+		h = uintHashCode(key)
+	} else {
+		h = m.hasher.Hash(key)
+	}
+	return &m.shards[h>>(bitsPerHashCode-m.shardBits)]
+}
+
+func (m *ConcurrentUintMap) ShardCount() int {
+	return len(m.shards)
+}
+
+func (m *ConcurrentUintMap) Get(key uint) uint {
+	sh := m.shard(key)
+	sh.RLock()
+	v := sh.m.Get(key)
+	sh.RUnlock()
+	return v
+}
+func (m *ConcurrentUintMap) Exists(key uint) bool {
+	sh := m.shard(key)
+	sh.RLock()
+	ok := sh.m.find(key, false) != nil
+	sh.RUnlock()
+	return ok
+}
+func (m *ConcurrentUintMap) Put(key, value uint) {
+	sh := m.shard(key)
+	sh.Lock()
+	sh.m.find(key, true).value = value
+	sh.Unlock()
+}
+
+// Inc adds delta to the value of key and returns the new value
+func (m *ConcurrentUintMap) Inc(key, delta uint) uint {
+	sh := m.shard(key)
+	sh.Lock()
+	e := sh.m.find(key, true)
+	e.value += delta
+	v := e.value
+	sh.Unlock()
+	return v
+}
+
+// Dec subtracts delta from the value of key and returns the new value
+func (m *ConcurrentUintMap) Dec(key, delta uint) uint {
+	sh := m.shard(key)
+	sh.Lock()
+	e := sh.m.find(key, true)
+	e.value -= delta
+	v := e.value
+	sh.Unlock()
+	return v
+}
+func (m *ConcurrentUintMap) Delete(key uint) bool {
+	sh := m.shard(key)
+	sh.Lock()
+	ok := sh.m.Delete(key)
+	sh.Unlock()
+	return ok
+}
+
+// GetOrPut returns existing value of key (loaded == true) or stores and returns the given one
+func (m *ConcurrentUintMap) GetOrPut(key, value uint) (actual uint, loaded bool) {
+	sh := m.shard(key)
+	sh.Lock()
+	actual, loaded = sh.m.GetOrPut(key, value)
+	sh.Unlock()
+	return
+}
+
+// Len returns total number of entries. Under concurrent writes the result is approximate.
+func (m *ConcurrentUintMap) Len() uint {
+	var n uint
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.RLock()
+		n += sh.m.count
+		sh.RUnlock()
+	}
+	return n
+}
+
+func (m *ConcurrentUintMap) Clear() {
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.Lock()
+		sh.m.Clear()
+		sh.Unlock()
+	}
+}
+
+// Range calls f for every entry until f returns false.
+// Each shard is read-locked while it is walked, so f sees a consistent view of the shard.
+// f must not modify the map.
+func (m *ConcurrentUintMap) Range(f func(key, value uint) bool) {
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.RLock()
+		for it := sh.m.Iterator(); it.Next(); {
+			if !f(it.CurKey(), it.Cur()) {
+				sh.RUnlock()
+				return
+			}
+		}
+		sh.RUnlock()
+	}
+}
+
+// Compact compacts every shard, see UintMap.Compact
+func (m *ConcurrentUintMap) Compact() {
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.Lock()
+		sh.m.Compact()
+		sh.Unlock()
+	}
+}
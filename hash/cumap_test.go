@@ -0,0 +1,120 @@
+package hash
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConcurrentUintMapInc(t *testing.T) {
+	const workers = 8
+	const keys = 50000
+	m := NewConcurrentUintMap()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := uint(0); k < keys; k++ {
+				m.Inc(k, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, keys, m.Len())
+	for k := uint(0); k < keys; k++ {
+		assert.EqualValues(t, workers, m.Get(k))
+	}
+	n := 0
+	m.Range(func(k, v uint) bool {
+		n++
+		assert.True(t, k < keys)
+		assert.EqualValues(t, workers, v)
+		return true
+	})
+	assert.Equal(t, keys, n)
+}
+
+func Test_ConcurrentUintMapGetOrPutDelete(t *testing.T) {
+	const workers = 8
+	const keys = 20000
+	m := NewConcurrentUintMap(3)
+	assert.Equal(t, 8, m.ShardCount())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := make(map[uint]uint)
+	for w := uint(0); w < workers; w++ {
+		wg.Add(1)
+		go func(w uint) {
+			defer wg.Done()
+			for k := uint(0); k < keys; k++ {
+				if _, loaded := m.GetOrPut(k, w); !loaded {
+					mu.Lock()
+					winners[k] = w
+					mu.Unlock()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(t, keys, len(winners))
+	for k, w := range winners {
+		v, loaded := m.GetOrPut(k, 1000)
+		assert.True(t, loaded)
+		assert.Equal(t, w, v)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for k := uint(w); k < keys; k += workers {
+				assert.True(t, m.Delete(k))
+				assert.False(t, m.Exists(k))
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 0, m.Len())
+}
+
+func Test_ConcurrentUintMapRangeStop(t *testing.T) {
+	m := NewConcurrentUintMap(0)
+	for k := uint(0); k < 1000; k++ {
+		m.Put(k, k)
+	}
+	n := 0
+	m.Range(func(k, v uint) bool {
+		n++
+		return n < 10
+	})
+	assert.Equal(t, 10, n)
+	m.Clear()
+	assert.EqualValues(t, 0, m.Len())
+}
+
+func Benchmark_ConcurrentUintMapInc(b *testing.B) {
+	m := NewConcurrentUintMap()
+	b.RunParallel(func(pb *testing.PB) {
+		k := uint(0)
+		for pb.Next() {
+			m.Inc(k&0xffff, 1)
+			k++
+		}
+	})
+}
+
+func Benchmark_MutexUintMapInc(b *testing.B) {
+	m := NewUintMap()
+	var mu sync.Mutex
+	b.RunParallel(func(pb *testing.PB) {
+		k := uint(0)
+		for pb.Next() {
+			mu.Lock()
+			m.Inc(k&0xffff, 1)
+			mu.Unlock()
+			k++
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package hash
+
+//
+// ConcurrentUintSet
+// Set of uints safe for concurrent use. Sharded the same way as ConcurrentUintMap.
+//
+
+// prefix: cus
+
+import "sync"
+
+type cusShard struct {
+	sync.RWMutex
+	s UintSet
+	_ [64]byte
+}
+
+type ConcurrentUintSet struct {
+	shardBits uint
+	shards    []cusShard
+	hasher    Hasher
+}
+
+// NewConcurrentUintSet creates set with 2^shardBits shards. Optional arguments are shard bits and Hasher.
+// By default number of shards is derived from the number of CPUs.
+func NewConcurrentUintSet(args ...interface{}) *ConcurrentUintSet {
+	o := parseContainerOptions(args, "usage: NewConcurrentUintSet([shardBits], [hasher])")
+	o.plainOnly("usage: NewConcurrentUintSet([shardBits], [hasher])")
+	s := &ConcurrentUintSet{hasher: o.hasher}
+	s.shardBits = o.shardBitsOption()
+	s.shards = make([]cusShard, 1<<s.shardBits)
+	for i := range s.shards {
+		s.shards[i].s.hasher = o.hasher
+		s.shards[i].s.shift = s.shardBits
+		s.shards[i].s.init(defaultHashDirBits)
+	}
+	return s
+}
+
+func (s *ConcurrentUintSet) shard(value uint) *cusShard {
+	var h uint
+	if s.hasher == nil {
+		h = uintHashCode(value)
+	} else {
+		h = s.hasher.Hash(value)
+	}
+	return &s.shards[h>>(bitsPerHashCode-s.shardBits)]
+}
+
+func (s *ConcurrentUintSet) ShardCount() int {
+	return len(s.shards)
+}
+
+func (s *ConcurrentUintSet) Includes(value uint) bool {
+	sh := s.shard(value)
+	sh.RLock()
+	ok := sh.s.Includes(value)
+	sh.RUnlock()
+	return ok
+}
+
+// Add inserts value and reports whether it was not in the set before
+func (s *ConcurrentUintSet) Add(value uint) bool {
+	sh := s.shard(value)
+	sh.Lock()
+	n := sh.s.count
+	sh.s.Add(value)
+	added := sh.s.count != n
+	sh.Unlock()
+	return added
+}
+func (s *ConcurrentUintSet) Delete(value uint) bool {
+	sh := s.shard(value)
+	sh.Lock()
+	ok := sh.s.Delete(value)
+	sh.Unlock()
+	return ok
+}
+
+// Len returns total number of elements. Under concurrent writes the result is approximate.
+func (s *ConcurrentUintSet) Len() uint {
+	var n uint
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.RLock()
+		n += sh.s.count
+		sh.RUnlock()
+	}
+	return n
+}
+
+func (s *ConcurrentUintSet) Clear() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.Lock()
+		sh.s.Clear()
+		sh.Unlock()
+	}
+}
+
+// Range calls f for every element until f returns false.
+// Each shard is read-locked while it is walked, so f sees a consistent view of the shard.
+// f must not modify the set.
+func (s *ConcurrentUintSet) Range(f func(value uint) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.RLock()
+		for bi, ei := sh.s.seekFirst(); bi != -1; bi, ei = sh.s.seekNext(bi, ei) {
+			v := uint(0)
+			if ei != -1 {
+				v = sh.s.dir[bi].values[ei]
+			}
+			if !f(v) {
+				sh.RUnlock()
+				return
+			}
+		}
+		sh.RUnlock()
+	}
+}
+
+// Compact compacts every shard, see UintSet.Compact
+func (s *ConcurrentUintSet) Compact() {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.Lock()
+		sh.s.Compact()
+		sh.Unlock()
+	}
+}
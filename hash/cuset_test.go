@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConcurrentUintSet(t *testing.T) {
+	const workers = 8
+	const values = 50000
+	s := NewConcurrentUintSet()
+	var wg sync.WaitGroup
+	added := make([]uint, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for v := uint(0); v < values; v++ {
+				if s.Add(v) {
+					added[w]++
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	total := uint(0)
+	for _, n := range added {
+		total += n
+	}
+	assert.EqualValues(t, values, total)
+	assert.EqualValues(t, values, s.Len())
+
+	seen := make(map[uint]bool)
+	s.Range(func(v uint) bool {
+		assert.False(t, seen[v])
+		seen[v] = true
+		return true
+	})
+	assert.Equal(t, values, len(seen))
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for v := uint(w); v < values; v += workers {
+				assert.True(t, s.Delete(v))
+				assert.False(t, s.Includes(v))
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 0, s.Len())
+}
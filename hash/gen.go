@@ -0,0 +1,7 @@
+package hash
+
+// Specialized maps and sets generated by cmd/genmap
+
+//go:generate go run ./cmd/genmap -name Uint32Float64Map -key uint32 -value float64 -test
+//go:generate go run ./cmd/genmap -name Uint32Int64Map -key uint32 -value int64 -test
+//go:generate go run ./cmd/genmap -name Uint32Set -key uint32 -test
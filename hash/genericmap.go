@@ -11,32 +11,54 @@ type genericHashMapBucket struct {
 	entries [entriesPerHashBucket]genericHashMapEntry
 }
 
+// GenericHashMapIterator walks over map entries in no particular order.
+// Map must not be modified during iteration except by DeleteCurrent.
 type GenericHashMapIterator struct {
 	m                               *GenericHashMap
 	started                         bool
+	deleted                         bool // current entry was deleted, its slot must be examined again
 	curBucketIndex, curElementIndex int
+	mods                            uint
+	skip                            []uint // visited keys moved ahead of the cursor by DeleteCurrent
 }
 
 func (it *GenericHashMapIterator) Reset() {
 	it.started = false
 }
 
+func (it *GenericHashMapIterator) check() {
+	if it.mods != it.m.mods {
+		panic(ConcurrentModificationError)
+	}
+}
+
 func (it *GenericHashMapIterator) Next() bool {
 	if !it.started {
 		it.started = true
+		it.deleted = false
+		it.skip = it.skip[:0]
+		it.mods = it.m.mods
 		it.curBucketIndex = 0
 		it.curElementIndex = -1
 		if it.m.zeroEntryAssigned {
 			return true
 		}
 	}
+	it.check()
 	if it.curBucketIndex == len(it.m.dir) {
 		return false
 	}
+	if it.deleted {
+		it.deleted = false
+		if it.curElementIndex != -1 {
+			it.curElementIndex--
+		}
+	}
 	for {
 		it.curElementIndex++
 		if it.curElementIndex == entriesPerHashBucket {
 			it.curElementIndex = 0
+			it.skip = it.skip[:0]
 			for {
 				it.curBucketIndex++
 				if it.curBucketIndex == len(it.m.dir) {
@@ -47,51 +69,98 @@ func (it *GenericHashMapIterator) Next() bool {
 				}
 			}
 		}
-		if it.m.dir[it.curBucketIndex].entries[it.curElementIndex].key != 0 {
+		if k := it.m.dir[it.curBucketIndex].entries[it.curElementIndex].key; k != 0 {
+			if len(it.skip) != 0 {
+				var ok bool
+				if it.skip, ok = skipped(it.skip, k); ok {
+					continue
+				}
+			}
 			return true
 		}
 	}
 }
-func (it *GenericHashMapIterator) CurKey() uint {
+func (it *GenericHashMapIterator) checkCurrent() {
 	if !it.started {
 		panic("accessing unstarted iterator")
 	}
+	it.check()
+	if it.deleted {
+		panic("current entry deleted")
+	}
+}
+func (it *GenericHashMapIterator) CurKey() uint {
+	it.checkCurrent()
 	if it.curElementIndex == -1 {
 		return 0 // zero entry key
 	}
 	return it.m.dir[it.curBucketIndex].entries[it.curElementIndex].key
 }
 func (it *GenericHashMapIterator) Cur() interface{} {
-	if !it.started {
-		panic("accessing unstarted iter")
-	}
+	it.checkCurrent()
 	if it.curElementIndex == -1 {
 		return it.m.zeroEntry.value
 	}
 	return it.m.dir[it.curBucketIndex].entries[it.curElementIndex].value
 }
 
+// DeleteCurrent removes current entry from the map. Iteration continues with Next as usual,
+// every remaining entry is still visited exactly once.
+func (it *GenericHashMapIterator) DeleteCurrent() {
+	it.checkCurrent()
+	m := it.m
+	if it.curElementIndex == -1 {
+		m.zeroEntryAssigned = false
+		m.zeroEntry.value = nil
+	} else {
+		b := m.dir[it.curBucketIndex]
+		it.skip = appendWrapped(it.skip, it.curElementIndex, func(i int) uint { return b.entries[i].key })
+		m.removeAt(b, uint(it.curElementIndex))
+		b.count--
+	}
+	m.count--
+	m.mods++
+	it.mods = m.mods
+	it.deleted = true
+}
+
 type GenericHashMap struct {
 	dirBits           uint
 	zeroEntry         genericHashMapEntry
 	zeroEntryAssigned bool
 	dir               []*genericHashMapBucket
 	count             uint
+	hasher            Hasher
+	mods              uint // structural modification counter for fail-fast iterators
+	splits, merges    uint // bucket splits and merges since init, reported by Stats
 }
 
-func NewMap() *GenericHashMap {
-	m := &GenericHashMap{}
-	m.init(defaultHashDirBits)
+// NewMap creates map. Optional arguments are initial directory bits and Hasher.
+func NewMap(args ...interface{}) *GenericHashMap {
+	o := parseContainerOptions(args, "usage: NewMap([initDirBits], [hasher])")
+	o.plainOnly("usage: NewMap([initDirBits], [hasher])")
+	m := &GenericHashMap{hasher: o.hasher}
+	m.init(o.dirBitsOption())
 
 	return m
 }
 
+func (m *GenericHashMap) hash(key uint) uint {
+	if m.hasher == nil {
+		return uintHashCode(key)
+	}
+	return m.hasher.Hash(key)
+}
+
 func (m *GenericHashMap) init(bits uint) {
 	initSize := 1 << bits
 	m.dirBits = bits
 	m.dir = make([]*genericHashMapBucket, initSize)
 	m.count = 0
+	m.zeroEntry = genericHashMapEntry{}
 	m.zeroEntryAssigned = false
+	m.mods++
+	m.splits, m.merges = 0, 0
 
 	firstBucket := &genericHashMapBucket{}
 
@@ -118,25 +187,167 @@ func (m *GenericHashMap) Get(key uint) (interface{}, bool) {
 func (m *GenericHashMap) Put(key uint, value interface{}) {
 	m.find(key, true).value = value
 }
+
+// GetOrPut returns value of key if it is present (loaded is true), otherwise puts value
+func (m *GenericHashMap) GetOrPut(key uint, value interface{}) (actual interface{}, loaded bool) {
+	count := m.count
+	e := m.find(key, true)
+	if m.count == count {
+		return e.value, true
+	}
+	e.value = value
+	return value, false
+}
+
+// Update calls f with value of key and whether it is present. If f returns keep, the key gets
+// the returned value, otherwise it is deleted (or stays absent). f must not modify the map.
+func (m *GenericHashMap) Update(key uint, f func(old interface{}, exists bool) (value interface{}, keep bool)) {
+	e := m.find(key, false)
+	if e == nil {
+		if value, keep := f(nil, false); keep {
+			m.find(key, true).value = value
+		}
+		return
+	}
+	value, keep := f(e.value, true)
+	if keep {
+		e.value = value
+	} else {
+		m.Delete(key)
+	}
+}
 func (m *GenericHashMap) Exists(key uint) bool {
 	return m.find(key, false) != nil
 }
-func (m *GenericHashMap) Delete(key uint) {
+func (m *GenericHashMap) IncludesKey(key uint) bool {
+	return m.Exists(key)
+}
+func (m *GenericHashMap) Delete(key uint) bool {
 	if key == 0 {
 		if m.zeroEntryAssigned {
 			m.zeroEntryAssigned = false
+			m.zeroEntry.value = nil
 			m.count--
+			m.mods++
+			return true
 		}
-	} else {
-		panic("implement Delete")
+		return false
+	}
+	h := m.hash(key)
+	dirIndex := h >> (bitsPerHashCode - m.dirBits)
+	elemIndex := h % entriesPerHashBucket
+	home := elemIndex
+	b := m.dir[dirIndex]
+	for {
+		if b.entries[elemIndex].key == key {
+			break
+		}
+		if b.entries[elemIndex].key == 0 {
+			return false
+		}
+
+		elemIndex = (elemIndex + 1) % entriesPerHashBucket
+		if elemIndex == home {
+			return false
+		}
+	}
+	m.removeAt(b, elemIndex)
+	b.count--
+	m.count--
+	m.mods++
+	if b.count <= mergeHashBucketThreshold {
+		m.merge(h)
+	}
+	return true
+}
+
+// merge joins bucket of hash code h with its buddy while both fit under merge threshold
+func (m *GenericHashMap) merge(h uint) {
+	for {
+		dirIndex := h >> (bitsPerHashCode - m.dirBits)
+		b := m.dir[dirIndex]
+		if b.bits == 0 {
+			return
+		}
+		shift := m.dirBits - b.bits
+		buddy := m.dir[(dirIndex>>shift^1)<<shift]
+		if buddy.bits != b.bits || b.count+buddy.count > mergeHashBucketThreshold {
+			return
+		}
+		// with linear probing entries of b keep their slots, only buddy's entries move
+		for index := 0; index < entriesPerHashBucket; index++ {
+			if buddy.entries[index].key == 0 {
+				continue
+			}
+			elemLoc := m.hash(buddy.entries[index].key) % entriesPerHashBucket
+			for ; b.entries[elemLoc].key != 0; elemLoc = (elemLoc + 1) % entriesPerHashBucket {
+			}
+			b.entries[elemLoc] = buddy.entries[index]
+		}
+		b.count += buddy.count
+		b.bits--
+		m.merges++
+		dirStart := (dirIndex >> (shift + 1)) << (shift + 1)
+		dirEnd := dirStart + 1<<(shift+1)
+		for index := dirStart; index < dirEnd; index++ {
+			m.dir[index] = b
+		}
+	}
+}
+
+// removeAt empties slot elemIndex of bucket b and moves back entries of the probe sequence after it
+func (m *GenericHashMap) removeAt(b *genericHashMapBucket, elemIndex uint) {
+	b.entries[elemIndex] = genericHashMapEntry{}
+	lastIndex := elemIndex
+	elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	for elemIndex != lastIndex && b.entries[elemIndex].key != 0 {
+		home := m.hash(b.entries[elemIndex].key) % entriesPerHashBucket
+		if (lastIndex < elemIndex && (home <= lastIndex || home > elemIndex)) || (lastIndex > elemIndex && home <= lastIndex && home > elemIndex) {
+			b.entries[lastIndex] = b.entries[elemIndex]
+			// release moved value, so the vacated slot does not keep it reachable
+			b.entries[elemIndex] = genericHashMapEntry{}
+			lastIndex = elemIndex
+		}
+		elemIndex = (elemIndex + 1) % entriesPerHashBucket
 	}
 }
 func (m *GenericHashMap) Len() uint {
 	return m.count
 }
+func (m *GenericHashMap) DirSize() int {
+	return len(m.dir)
+}
+func (m *GenericHashMap) BucketCount() int {
+	c := 1
+	for i := 1; i < len(m.dir); i++ {
+		if m.dir[i] != m.dir[i-1] {
+			c++
+		}
+	}
+	return c
+}
+func (m *GenericHashMap) Do(f func(uint, interface{})) {
+	if m.zeroEntryAssigned {
+		f(0, m.zeroEntry.value)
+	}
+	di := 0
+	for {
+		b := m.dir[di]
+		for i := 0; i < entriesPerHashBucket; i++ {
+			if b.entries[i].key != 0 {
+				f(b.entries[i].key, b.entries[i].value)
+			}
+		}
+		for di++; di < len(m.dir) && m.dir[di] == m.dir[di-1]; di++ {
+		}
+		if di == len(m.dir) {
+			return
+		}
+	}
+}
 
 func (m *GenericHashMap) split(key uint) {
-	h := uintHashCode(key)
+	h := m.hash(key)
 
 	for {
 		dirIndex := h >> (bitsPerHashCode - m.dirBits)
@@ -145,6 +356,7 @@ func (m *GenericHashMap) split(key uint) {
 			return // successfully splitted
 		}
 		newBits := splitBucket.bits + 1
+		m.splits++
 
 		workBuckets := [2]*genericHashMapBucket{
 			&genericHashMapBucket{bits: newBits},
@@ -164,8 +376,10 @@ func (m *GenericHashMap) split(key uint) {
 		}
 
 		// Copy all elements from split bucket into the new buckets
+		var diff uint
 		for index := 0; index < entriesPerHashBucket; index++ {
-			hash := uintHashCode(splitBucket.entries[index].key)
+			hash := m.hash(splitBucket.entries[index].key)
+			diff |= hash ^ h
 			sel := (hash >> (bitsPerHashCode - newBits)) & 1
 			bp := workBuckets[sel]
 			elemLoc := hash % entriesPerHashBucket
@@ -174,6 +388,9 @@ func (m *GenericHashMap) split(key uint) {
 			bp.entries[elemLoc] = splitBucket.entries[index]
 			bp.count++
 		}
+		if diff == 0 {
+			panic(HashCollisionError)
+		}
 
 		// replace splitBucket with first work bucket
 		dirIndex = h >> (bitsPerHashCode - m.dirBits)
@@ -207,13 +424,14 @@ func (m *GenericHashMap) find(key uint, addIfNotExists bool) *genericHashMapEntr
 		if !m.zeroEntryAssigned && addIfNotExists {
 			m.zeroEntryAssigned = true
 			m.count++
+			m.mods++
 		}
 		if m.zeroEntryAssigned {
 			return &m.zeroEntry
 		}
 		return nil
 	}
-	h := uintHashCode(key)
+	h := m.hash(key)
 	dirIndex := h >> (bitsPerHashCode - m.dirBits)
 	elementIndex := h % entriesPerHashBucket
 	b := m.dir[dirIndex]
@@ -245,5 +463,6 @@ func (m *GenericHashMap) find(key uint, addIfNotExists bool) *genericHashMapEntr
 	b.count++
 	b.entries[elementIndex].key = key
 	m.count++
+	m.mods++
 	return &b.entries[elementIndex]
 }
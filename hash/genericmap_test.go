@@ -1,4 +1,171 @@
 package hash
 
-// todo
+import (
+	"runtime"
+	"testing"
 
+	. "github.com/pi/goal/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GenericMapGetPut(t *testing.T) {
+	m := NewMap()
+	kg := newKeygen()
+	for i := 0; i < N; i++ {
+		m.Put(kg.Next(), i)
+	}
+	kg.Reset()
+	for i := 0; i < N; i++ {
+		v, ok := m.Get(kg.Next())
+		assert.True(t, ok)
+		assert.Equal(t, i, v)
+	}
+	assert.EqualValues(t, N, m.Len())
+}
+
+func Test_GenericMapDelete(t *testing.T) {
+	m := NewMap()
+	kg := newKeygen()
+	for i := 0; i < N; i++ {
+		k := kg.Next()
+		m.Put(k, ^k)
+	}
+	kg.Reset()
+	for i := 0; i < N; i++ {
+		k := kg.Next()
+		if (i & 1) == 1 {
+			assert.True(t, m.Delete(k))
+			assert.False(t, m.Delete(k))
+		}
+	}
+	assert.EqualValues(t, N/2, m.Len())
+	kg.Reset()
+	for i := 0; i < N; i++ {
+		k := kg.Next()
+		v, ok := m.Get(k)
+		if (i & 1) == 1 {
+			assert.False(t, ok)
+		} else {
+			assert.True(t, ok)
+			assert.Equal(t, ^k, v)
+		}
+	}
+	n := uint(0)
+	m.Do(func(k uint, v interface{}) {
+		n++
+		assert.Equal(t, ^k, v)
+	})
+	assert.Equal(t, m.Len(), n)
+
+	m.Put(0, 33)
+	assert.True(t, m.IncludesKey(0))
+	assert.True(t, m.Delete(0))
+	assert.False(t, m.IncludesKey(0))
+	assert.False(t, m.Delete(0))
+}
+
+func Test_GenericMapDeleteReleasesValue(t *testing.T) {
+	m := NewMap()
+	released := make(chan struct{})
+	v := new([64]byte)
+	runtime.SetFinalizer(v, func(*[64]byte) { close(released) })
+	m.Put(12345, v)
+	v = nil
+	assert.True(t, m.Delete(12345))
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		select {
+		case <-released:
+			return
+		default:
+		}
+	}
+	t.Fatal("deleted value is still reachable")
+}
+
+func Test_GenericMapReinsertAfterDelete(t *testing.T) {
+	m := NewMap()
+	for i := uint(1); i <= 10000; i++ {
+		m.Put(i, i)
+	}
+	bc := m.BucketCount()
+	for round := 0; round < 10; round++ {
+		for i := uint(1); i <= 10000; i++ {
+			assert.True(t, m.Delete(i))
+		}
+		assert.EqualValues(t, 0, m.Len())
+		for i := uint(1); i <= 10000; i++ {
+			m.Put(i, i)
+		}
+	}
+	// freed slots must be reused instead of forcing new splits
+	assert.Equal(t, bc, m.BucketCount())
+	assert.True(t, m.DirSize() >= m.BucketCount())
+}
+
+func Test_GenericMapIterDeleteCurrent(t *testing.T) {
+	const n = 20000
+	m := NewMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(i, i)
+	}
+	it := m.Iterator()
+	assert.True(t, it.Next())
+	m.Put(n, 0)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Next() })
+	m.Delete(n)
+
+	seen := make(map[uint]bool)
+	del := true
+	for it := m.Iterator(); it.Next(); {
+		k := it.CurKey()
+		assert.False(t, seen[k])
+		seen[k] = true
+		assert.Equal(t, k, it.Cur())
+		if del {
+			it.DeleteCurrent()
+		}
+		del = !del
+	}
+	assert.Equal(t, n, len(seen))
+	assert.EqualValues(t, n/2, m.Len())
+	m.Do(func(k uint, v interface{}) {
+		assert.Equal(t, k, v)
+		assert.True(t, seen[k])
+	})
+}
+
+func Test_GenericMapUpdate(t *testing.T) {
+	m := NewMap()
+	inc := func(old interface{}, exists bool) (interface{}, bool) {
+		if !exists {
+			return 1, true
+		}
+		return old.(int) + 1, true
+	}
+	for _, k := range []uint{0, 5, 0, 7, 5, 0} {
+		m.Update(k, inc)
+	}
+	for k, n := range map[uint]int{0: 3, 5: 2, 7: 1} {
+		v, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, n, v)
+	}
+	drop := func(interface{}, bool) (interface{}, bool) { return nil, false }
+	m.Update(5, drop)
+	m.Update(0, drop)
+	m.Update(9, drop)
+	assert.False(t, m.Exists(5))
+	assert.False(t, m.Exists(0))
+	assert.False(t, m.Exists(9))
+	assert.EqualValues(t, 1, m.Len())
+
+	v, loaded := m.GetOrPut(7, "x")
+	assert.True(t, loaded)
+	assert.Equal(t, 1, v)
+	v, loaded = m.GetOrPut(0, "x")
+	assert.False(t, loaded)
+	assert.Equal(t, "x", v)
+	v, _ = m.Get(0)
+	assert.Equal(t, "x", v)
+}
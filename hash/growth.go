@@ -0,0 +1,131 @@
+package hash
+
+//
+// Incremental directory doubling of UintMap and UintSet.
+//
+// Doubling a directory of 2^24 slots allocates and fills 2^25 pointers in one call, a stall of
+// milliseconds. With IncrementalGrowth the next doubling starts as soon as a split creates
+// buckets as deep as the directory, i.e. as soon as the next split of such bucket would
+// need it. The doubled directory is filled alongside the current one: every insert or delete
+// copies growthStep slots, and when all are copied the containers switch to it.
+//
+// The current directory stays authoritative until the switch, so lookups and iteration do not
+// change at all. Splits and merges write directory slots through setDir, which mirrors slots
+// already copied into the doubled directory. A split which needs the doubled directory before
+// it is complete finishes the copying at once; with uniform hash codes the copying completes
+// long before that (the doubled directory costs 8 bytes per slot, well under 1% of buckets).
+// Compact shrinks directory and abandons the doubling in progress.
+//
+
+// prefix: grow
+
+type incrementalOption struct{}
+
+// IncrementalGrowth passed to NewUintMap or NewUintSet spreads directory doubling over
+// following inserts and deletes
+var IncrementalGrowth incrementalOption
+
+// number of directory slots copied by one insert or delete
+const growthStep = 1024
+
+// UintMap
+
+func (m *UintMap) setDir(i uint, b *uumBucket) {
+	m.dir[i] = b
+	if i < m.grown {
+		m.growDir[2*i] = b
+		m.growDir[2*i+1] = b
+	}
+}
+
+func (m *UintMap) startGrowth() {
+	m.growDir = m.newDir(2 * len(m.dir))
+	m.grown = 0
+}
+
+// growTo copies directory slots up to end into doubled directory, switching to it when done
+func (m *UintMap) growTo(end uint) {
+	if n := uint(len(m.dir)); end > n {
+		end = n
+	}
+	for i := m.grown; i < end; i++ {
+		m.growDir[2*i] = m.dir[i]
+		m.growDir[2*i+1] = m.dir[i]
+	}
+	m.grown = end
+	if end == uint(len(m.dir)) {
+		m.freeDir(m.dir)
+		m.dir, m.growDir = m.growDir, nil
+		m.dirBits++
+		m.grown = 0
+		m.mods++
+	}
+}
+
+func (m *UintMap) growStep() {
+	m.growTo(m.grown + growthStep)
+}
+
+func (m *UintMap) finishGrowth() {
+	if m.growDir != nil {
+		m.growTo(uint(len(m.dir)))
+	}
+}
+
+func (m *UintMap) cancelGrowth() {
+	if m.growDir != nil {
+		m.freeDir(m.growDir)
+		m.growDir, m.grown = nil, 0
+	}
+}
+
+// UintSet
+
+func (s *UintSet) setDir(i uint, b *usBucket) {
+	s.dir[i] = b
+	if i < s.grown {
+		s.growDir[2*i] = b
+		s.growDir[2*i+1] = b
+	}
+}
+
+func (s *UintSet) startGrowth() {
+	s.growDir = s.newDir(2 * len(s.dir))
+	s.grown = 0
+}
+
+// growTo copies directory slots up to end into doubled directory, switching to it when done
+func (s *UintSet) growTo(end uint) {
+	if n := uint(len(s.dir)); end > n {
+		end = n
+	}
+	for i := s.grown; i < end; i++ {
+		s.growDir[2*i] = s.dir[i]
+		s.growDir[2*i+1] = s.dir[i]
+	}
+	s.grown = end
+	if end == uint(len(s.dir)) {
+		s.freeDir(s.dir)
+		s.dir, s.growDir = s.growDir, nil
+		s.dirBits++
+		s.grown = 0
+		s.mods++
+	}
+}
+
+func (s *UintSet) growStep() {
+	s.growTo(s.grown + growthStep)
+}
+
+func (s *UintSet) finishGrowth() {
+	if s.growDir != nil {
+		s.growTo(uint(len(s.dir)))
+	}
+}
+
+func (s *UintSet) cancelGrowth() {
+	if s.growDir != nil {
+		s.freeDir(s.growDir)
+		s.growDir, s.grown = nil, 0
+	}
+}
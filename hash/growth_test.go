@@ -0,0 +1,136 @@
+package hash
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkUintMapGrowth verifies that copied slots of the doubled directory mirror the current one
+func checkUintMapGrowth(t *testing.T, m *UintMap) {
+	if m.growDir == nil {
+		return
+	}
+	assert.Equal(t, 2*len(m.dir), len(m.growDir))
+	for i := uint(0); i < m.grown; i++ {
+		if m.growDir[2*i] != m.dir[i] || m.growDir[2*i+1] != m.dir[i] {
+			t.Fatalf("slot %d of %d is not mirrored", i, m.grown)
+		}
+	}
+}
+
+func Test_UintMapIncrementalGrowth(t *testing.T) {
+	const n = 1 << 20
+	m := NewUintMap(IncrementalGrowth)
+	model := make(map[uint]uint)
+	r := rand.New(rand.NewSource(1))
+	growing, maxDir := 0, 0
+	for i := 0; i < 3*n; i++ {
+		k := uint(r.Intn(n))
+		if i > 2*n && r.Intn(2) == 0 {
+			assert.Equal(t, model[k] != 0, m.Delete(k))
+			delete(model, k)
+		} else {
+			m.Inc(k, 1)
+			model[k]++
+		}
+		if m.growDir != nil {
+			growing++
+			if i%1000 == 0 {
+				checkUintMapGrowth(t, m)
+			}
+		}
+		if len(m.dir) > maxDir {
+			maxDir = len(m.dir)
+		}
+	}
+	assert.True(t, growing > 0)
+	assert.True(t, maxDir >= 1<<12)
+	checkUintMapGrowth(t, m)
+	assert.EqualValues(t, len(model), m.Len())
+	for k, v := range model {
+		if m.Get(k) != v {
+			t.Fatalf("%d: %d != %d", k, m.Get(k), v)
+		}
+	}
+	cnt := 0
+	m.Do(func(k, v uint) {
+		assert.Equal(t, model[k], v)
+		cnt++
+	})
+	assert.Equal(t, len(model), cnt)
+
+	m.finishGrowth()
+	assert.Nil(t, m.growDir)
+	assert.Equal(t, 1<<m.dirBits, len(m.dir))
+	for k, v := range model {
+		assert.Equal(t, v, m.Get(k))
+	}
+
+	m.Compact()
+	assert.Nil(t, m.growDir)
+	for k := range model {
+		m.Delete(k)
+	}
+	assert.EqualValues(t, 0, m.Len())
+	assert.Panics(t, func() { NewMap(IncrementalGrowth) })
+}
+
+func Test_UintSetIncrementalGrowth(t *testing.T) {
+	const n = 1 << 20
+	s := NewUintSet(IncrementalGrowth, NewRandomHasher())
+	model := make(map[uint]bool)
+	r := rand.New(rand.NewSource(2))
+	growing := 0
+	for i := 0; i < 2*n; i++ {
+		v := uint(r.Intn(n))
+		if i > n && r.Intn(3) == 0 {
+			assert.Equal(t, model[v], s.Delete(v))
+			delete(model, v)
+		} else {
+			s.Add(v)
+			model[v] = true
+		}
+		if s.growDir != nil {
+			growing++
+			if i%1000 == 0 {
+				for j := uint(0); j < s.grown; j++ {
+					if s.growDir[2*j] != s.dir[j] || s.growDir[2*j+1] != s.dir[j] {
+						t.Fatalf("slot %d is not mirrored", j)
+					}
+				}
+			}
+		}
+	}
+	assert.True(t, growing > 0)
+	assert.EqualValues(t, len(model), s.Len())
+	for v := range model {
+		assert.True(t, s.Includes(v))
+	}
+	c := s.Clone()
+	c.Add(n + 1)
+	assert.True(t, c.incremental)
+	assert.True(t, c.Includes(n+1))
+	assert.False(t, s.Includes(n+1))
+}
+
+func Test_IncrementalGrowthOffHeap(t *testing.T) {
+	m := NewUintMap(IncrementalGrowth, OffHeap)
+	defer m.Free()
+	for i := uint(0); i < 500000; i++ {
+		m.Put(i, i)
+	}
+	data, err := m.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, m.UnmarshalBinary(data))
+	assert.True(t, m.incremental)
+	for i := uint(500000); i < 1000000; i++ {
+		m.Put(i, i)
+	}
+	for i := uint(0); i < 1000000; i++ {
+		if m.Get(i) != i {
+			t.Fatalf("%d: %d", i, m.Get(i))
+		}
+	}
+}
@@ -1,9 +1,53 @@
 package hash
 
-import "github.com/pi/goal/md"
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/pi/goal/md"
+)
 
 const bitsPerHashCode = md.BitsPerUint
 
 func uintHashCode(key uint) uint {
 	return key * 0xc4ceb9fe1a85ec53
 }
+
+// UintHashCode returns hash code of key used by containers without Hasher
+func UintHashCode(key uint) uint {
+	return uintHashCode(key)
+}
+
+// splitmix64 finalizer, every input bit affects every output bit
+func mix64(x uint) uint {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+const (
+	bytesHashPrime1 = 0x9e3779b97f4a7c15
+	bytesHashPrime2 = 0xc2b2ae3d27d4eb4f
+)
+
+func bytesHashCode(b []byte) uint {
+	return seededBytesHashCode(b, 0)
+}
+
+// seededBytesHashCode is bytesHashCode with seed mixed into every word,
+// so that keys crafted to collide for one seed do not collide for others
+func seededBytesHashCode(b []byte, seed uint) uint {
+	h := uint(len(b))*bytesHashPrime1 ^ seed
+	for ; len(b) >= 8; b = b[8:] {
+		k := (uint(binary.LittleEndian.Uint64(b)) ^ seed) * bytesHashPrime2
+		h = bits.RotateLeft(h^k, 31) * bytesHashPrime1
+	}
+	if len(b) > 0 {
+		var k uint
+		for i := len(b) - 1; i >= 0; i-- {
+			k = k<<8 | uint(b[i])
+		}
+		h = bits.RotateLeft(h^((k^seed)*bytesHashPrime2), 31) * bytesHashPrime1
+	}
+	return mix64(h)
+}
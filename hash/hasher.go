@@ -0,0 +1,167 @@
+package hash
+
+//
+// Pluggable hash functions for uint keyed containers.
+//
+// Containers take the directory slot from the top bits of hash code and the bucket slot from
+// hash code modulo entriesPerHashBucket, so a hasher must spread keys over both ends of the word.
+// Default hasher (nil) is the fixed multiplication by uintHashCode, it is the fastest one but
+// keys chosen with knowledge of the multiplier can share arbitrary long hash prefixes and force
+// the directory to double until it runs out of memory. Seeded hashers close that hole.
+//
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// HashCollisionError is panic value of containers which got more keys with equal hash code
+// than fit into a bucket. No split can separate such keys.
+var HashCollisionError = errors.New("too many keys with equal hash code, use seeded Hasher")
+
+type Hasher interface {
+	Hash(key uint) uint
+}
+
+// MultiplicativeHasher is the default hasher with additional seed. Cheap, but the seed only
+// shifts hash codes, so it does not protect against crafted keys.
+type MultiplicativeHasher struct {
+	Seed uint
+}
+
+func (h MultiplicativeHasher) Hash(key uint) uint {
+	return uintHashCode(key) + h.Seed
+}
+
+// SplitMix64Hasher applies splitmix64 finalizer to the seeded key
+type SplitMix64Hasher struct {
+	Seed uint
+}
+
+func (h SplitMix64Hasher) Hash(key uint) uint {
+	return mix64(key + h.Seed)
+}
+
+// WyHasher is wyhash64: two rounds of 128-bit multiply-fold. Unlike the other hashers it is not
+// a bijection, distinct keys may get equal hash codes, though with random seed such keys can't
+// be found in advance. Containers panic with HashCollisionError if more than a bucket of keys
+// shares a hash code.
+type WyHasher struct {
+	Seed uint
+}
+
+const (
+	wyp0 = 0xa0761d6478bd642f
+	wyp1 = 0xe7037ed1a0b428db
+)
+
+func (h WyHasher) Hash(key uint) uint {
+	seed := uint64(h.Seed) ^ wyp1
+	if seed == 0 {
+		// zero multiplier would map all keys to one hash code
+		seed = wyp0
+	}
+	hi, lo := bits.Mul64(uint64(key)^wyp0, seed)
+	hi, lo = bits.Mul64(lo^wyp0, hi^wyp1)
+	return uint(hi ^ lo)
+}
+
+var seedCounter uint64
+
+// RandomSeed returns unpredictable seed for hashers
+func RandomSeed() uint {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err == nil {
+		return uint(binary.LittleEndian.Uint64(b[:]))
+	}
+	// no entropy source, fall back to the clock
+	return mix64(uint(time.Now().UnixNano()) + uint(atomic.AddUint64(&seedCounter, 1))*bytesHashPrime1)
+}
+
+// NewRandomHasher returns strong hasher with random seed
+func NewRandomHasher() Hasher {
+	return WyHasher{Seed: RandomSeed()}
+}
+
+// sameHasher reports whether a and b are known to produce the same hash codes
+func sameHasher(a, b Hasher) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// containerOptions collects optional constructor arguments of hash containers
+type containerOptions struct {
+	bits        uint
+	bitsSet     bool
+	hasher      Hasher
+	offHeap     bool
+	incremental bool
+	robinHood   bool
+}
+
+func parseContainerOptions(args []interface{}, usage string) (o containerOptions) {
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			// nil hasher stands for the default one
+		case offHeapOption:
+			o.offHeap = true
+		case incrementalOption:
+			o.incremental = true
+		case robinHoodOption:
+			o.robinHood = true
+		case Hasher:
+			if o.hasher != nil {
+				panic(usage)
+			}
+			o.hasher = v
+		case uint, int, uint64, int64:
+			if o.bitsSet {
+				panic(usage)
+			}
+			o.bitsSet = true
+			switch v := v.(type) {
+			case uint:
+				o.bits = v
+			case int:
+				o.bits = uint(v)
+			case uint64:
+				o.bits = uint(v)
+			case int64:
+				o.bits = uint(v)
+			}
+		default:
+			panic(usage)
+		}
+	}
+	return
+}
+
+// plainOnly panics with usage if off-heap storage or incremental growth, supported by UintMap
+// and UintSet only, or Robin Hood probing, supported by UintMap only, was requested
+func (o *containerOptions) plainOnly(usage string) {
+	if o.offHeap || o.incremental || o.robinHood {
+		panic(usage)
+	}
+}
+
+// dirBitsOption returns initial directory bits from options
+func (o *containerOptions) dirBitsOption() uint {
+	if !o.bitsSet {
+		return defaultHashDirBits
+	}
+	if o.bits < 2 || o.bits > (bitsPerHashCode-3) {
+		panic("invalid init bits")
+	}
+	return o.bits
+}
@@ -0,0 +1,161 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/pi/goal/th"
+	"github.com/stretchr/testify/assert"
+)
+
+var testHashers = []struct {
+	name   string
+	hasher Hasher
+}{
+	{"default", nil},
+	{"multiplicative", MultiplicativeHasher{Seed: 12345}},
+	{"splitmix64", SplitMix64Hasher{Seed: 12345}},
+	{"wyhash", WyHasher{Seed: 12345}},
+}
+
+// inverse of the default multiplier modulo 2^64
+func uintHashCodeInverse() uint {
+	const m = 0xc4ceb9fe1a85ec53
+	inv := uint(m)
+	for i := 0; i < 5; i++ {
+		inv *= 2 - m*inv
+	}
+	return inv
+}
+
+// hostileKeys returns keys whose default hash codes share top 16 bits
+func hostileKeys(n int) []uint {
+	inv := uintHashCodeInverse()
+	g := th.NewSeqGen(th.SgSeq)
+	keys := make([]uint, n)
+	for i := range keys {
+		keys[i] = (g.Next() << 37) * inv
+	}
+	return keys
+}
+
+func Test_Hashers(t *testing.T) {
+	for _, h := range testHashers {
+		m := NewUintMap(h.hasher)
+		s := NewUintSet(6, h.hasher)
+		kg := th.NewSeqGen(th.SgRand)
+		for i := uint(0); i < 100000; i++ {
+			k := kg.Next()
+			m.Put(k, i)
+			s.Add(k)
+		}
+		kg.Reset()
+		for i := uint(0); i < 100000; i++ {
+			k := kg.Next()
+			assert.Equal(t, i, m.Get(k), h.name)
+			assert.True(t, s.Includes(k), h.name)
+		}
+		kg.Reset()
+		for i := uint(0); i < 1000; i++ {
+			assert.True(t, m.Delete(kg.Next()), h.name)
+		}
+		assert.EqualValues(t, 99000, m.Len(), h.name)
+		assert.EqualValues(t, 100000, s.Len(), h.name)
+	}
+}
+
+func Test_HostileKeys(t *testing.T) {
+	keys := hostileKeys(2000)
+	assert.Equal(t, uint(0), uintHashCode(keys[1999])>>48)
+
+	m := NewUintMap()
+	for _, k := range keys {
+		m.Inc(k, 1)
+	}
+	// every key hits the same directory prefix, directory has to grow far beyond the number of keys
+	assert.True(t, m.DirSize() >= 1<<18)
+
+	hashers := append(testHashers[2:], struct {
+		name   string
+		hasher Hasher
+	}{"wyhash degenerate seed", WyHasher{Seed: wyp1}})
+	for _, h := range hashers {
+		m := NewUintMap(h.hasher)
+		s := NewUintSet(h.hasher)
+		for _, k := range keys {
+			m.Inc(k, 1)
+			s.Add(k)
+		}
+		assert.True(t, m.DirSize() <= 64, h.name)
+		assert.True(t, s.memuse() < 1<<20, h.name)
+		for _, k := range keys {
+			assert.EqualValues(t, 1, m.Get(k))
+		}
+	}
+
+	cm := NewConcurrentUintMap(NewRandomHasher())
+	for _, k := range keys {
+		cm.Inc(k, 1)
+	}
+	assert.EqualValues(t, len(keys), cm.Len())
+}
+
+type constHasher struct{}
+
+func (constHasher) Hash(uint) uint { return 42 }
+
+func Test_HashCollision(t *testing.T) {
+	assert.NotEqual(t, WyHasher{Seed: wyp1}.Hash(1), WyHasher{Seed: wyp1}.Hash(2))
+
+	m := NewUintMap(constHasher{})
+	s := NewUintSet(constHasher{})
+	for i := uint(1); i <= entriesPerHashBucket; i++ {
+		m.Put(i, i)
+		s.Add(i)
+	}
+	assert.PanicsWithValue(t, HashCollisionError, func() { m.Put(entriesPerHashBucket+1, 0) })
+	assert.PanicsWithValue(t, HashCollisionError, func() { s.Add(entriesPerHashBucket + 1) })
+}
+
+func Test_HasherOptions(t *testing.T) {
+	assert.Panics(t, func() { NewUintMap(4, 5) })
+	assert.Panics(t, func() { NewUintMap(WyHasher{}, WyHasher{}) })
+	assert.Panics(t, func() { NewUintSet("4") })
+	assert.Panics(t, func() { NewUintMap(1) })
+	assert.Equal(t, 1<<6, NewUintMap(WyHasher{}, 6).DirSize())
+	assert.Equal(t, 1<<3, NewConcurrentUintMap(3, SplitMix64Hasher{}).ShardCount())
+
+	assert.True(t, sameHasher(nil, nil))
+	assert.True(t, sameHasher(WyHasher{Seed: 1}, WyHasher{Seed: 1}))
+	assert.False(t, sameHasher(WyHasher{Seed: 1}, WyHasher{Seed: 2}))
+	assert.False(t, sameHasher(WyHasher{Seed: 1}, SplitMix64Hasher{Seed: 1}))
+	assert.False(t, sameHasher(nil, WyHasher{}))
+	assert.NotEqual(t, RandomSeed(), RandomSeed())
+}
+
+func Test_HasherSnapshotMismatch(t *testing.T) {
+	m := NewUintMap(WyHasher{Seed: 1})
+	for i := uint(0); i < 10000; i++ {
+		m.Put(i, i)
+	}
+	data, err := m.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, SnapshotFormatError, NewUintMap().UnmarshalBinary(data))
+	r := NewUintMap(WyHasher{Seed: 1})
+	assert.NoError(t, r.UnmarshalBinary(data))
+	assert.EqualValues(t, 5000, r.Get(5000))
+}
+
+func benchmarkHasher(b *testing.B, h Hasher) {
+	g := th.NewSeqGen(th.SgRand)
+	g.SetPeriod(1 << 20)
+	m := NewUintMap(h)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Inc(g.Next(), 1)
+	}
+}
+
+func Benchmark_HasherDefault(b *testing.B)        { benchmarkHasher(b, nil) }
+func Benchmark_HasherMultiplicative(b *testing.B) { benchmarkHasher(b, MultiplicativeHasher{Seed: 1}) }
+func Benchmark_HasherSplitMix64(b *testing.B)     { benchmarkHasher(b, SplitMix64Hasher{Seed: 1}) }
+func Benchmark_HasherWy(b *testing.B)             { benchmarkHasher(b, WyHasher{Seed: 1}) }
@@ -0,0 +1,189 @@
+package hash
+
+//
+// Heavy hitters by Space-Saving (Metwally, Agrawal, El Abbadi).
+//
+// Tracker of capacity k keeps k monitored keys with counters in a min-heap and a UintMap from
+// key to heap position. A new key replaces the key with the smallest counter and inherits its
+// count as possible overcount. Every key occurring more than Total()/k times is monitored,
+// and a reported count exceeds the real one by at most the reported Error.
+//
+// Trackers are merged as described by Agarwal et al. ("Mergeable summaries"): a key missing
+// in a full tracker may have occurred up to its minimal count, so that count is added to both
+// count and error of such keys, and the k largest counters are kept.
+//
+
+// prefix: hh
+
+import "sort"
+
+// HeavyHitter is monitored key with its count, overcounted by at most Error
+type HeavyHitter struct {
+	Key, Count, Error uint
+}
+
+type HeavyHitters struct {
+	heap  []HeavyHitter // min-heap by Count
+	pos   *UintMap      // key to heap index + 1
+	k     int
+	total uint
+}
+
+// NewHeavyHitters creates tracker monitoring k keys
+func NewHeavyHitters(k int) *HeavyHitters {
+	if k < 1 {
+		panic("invalid number of monitored keys")
+	}
+	return &HeavyHitters{heap: make([]HeavyHitter, 0, k), pos: NewUintMap(), k: k}
+}
+
+func (t *HeavyHitters) swap(i, j int) {
+	t.heap[i], t.heap[j] = t.heap[j], t.heap[i]
+	t.pos.Put(t.heap[i].Key, uint(i+1))
+	t.pos.Put(t.heap[j].Key, uint(j+1))
+}
+
+func (t *HeavyHitters) up(i int) {
+	for i > 0 {
+		p := (i - 1) / 2
+		if t.heap[p].Count <= t.heap[i].Count {
+			return
+		}
+		t.swap(p, i)
+		i = p
+	}
+}
+
+func (t *HeavyHitters) down(i int) {
+	for {
+		min := i
+		if l := 2*i + 1; l < len(t.heap) && t.heap[l].Count < t.heap[min].Count {
+			min = l
+		}
+		if r := 2*i + 2; r < len(t.heap) && t.heap[r].Count < t.heap[min].Count {
+			min = r
+		}
+		if min == i {
+			return
+		}
+		t.swap(i, min)
+		i = min
+	}
+}
+
+// Add adds count occurrences of key
+func (t *HeavyHitters) Add(key, count uint) {
+	t.total += count
+	if p := t.pos.Get(key); p != 0 {
+		t.heap[p-1].Count += count
+		t.down(int(p - 1))
+		return
+	}
+	if len(t.heap) < t.k {
+		t.heap = append(t.heap, HeavyHitter{key, count, 0})
+		t.pos.Put(key, uint(len(t.heap)))
+		t.up(len(t.heap) - 1)
+		return
+	}
+	min := t.heap[0]
+	t.pos.Delete(min.Key)
+	t.heap[0] = HeavyHitter{key, min.Count + count, min.Count}
+	t.pos.Put(key, 1)
+	t.down(0)
+}
+
+// Estimate returns count of monitored key, or upper bound of count of other keys
+func (t *HeavyHitters) Estimate(key uint) uint {
+	if p := t.pos.Get(key); p != 0 {
+		return t.heap[p-1].Count
+	}
+	return t.minCount()
+}
+
+// minCount returns count any unmonitored key may have
+func (t *HeavyHitters) minCount() uint {
+	if len(t.heap) < t.k {
+		return 0
+	}
+	return t.heap[0].Count
+}
+
+// Top returns up to n monitored keys with largest counts, ordered by count descending
+func (t *HeavyHitters) Top(n int) []HeavyHitter {
+	r := append([]HeavyHitter(nil), t.heap...)
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Count > r[j].Count || (r[i].Count == r[j].Count && r[i].Key < r[j].Key)
+	})
+	if n < len(r) {
+		r = r[:n]
+	}
+	return r
+}
+
+// Guaranteed returns monitored keys whose count surely exceeds threshold, ordered by count descending
+func (t *HeavyHitters) Guaranteed(threshold uint) []HeavyHitter {
+	r := t.Top(len(t.heap))
+	n := 0
+	for _, h := range r {
+		if h.Count-h.Error > threshold {
+			r[n] = h
+			n++
+		}
+	}
+	return r[:n]
+}
+
+// Total returns sum of all counts added
+func (t *HeavyHitters) Total() uint {
+	return t.total
+}
+
+// Len returns number of monitored keys
+func (t *HeavyHitters) Len() int {
+	return len(t.heap)
+}
+
+func (t *HeavyHitters) Clear() {
+	t.heap = t.heap[:0]
+	t.pos.Clear()
+	t.total = 0
+}
+
+// Merge adds counts of o to t. Trackers must monitor the same number of keys.
+func (t *HeavyHitters) Merge(o *HeavyHitters) error {
+	if t.k != o.k {
+		return SketchMismatchError
+	}
+	tMin, oMin := t.minCount(), o.minCount()
+	all := make([]HeavyHitter, 0, len(t.heap)+len(o.heap))
+	for _, h := range t.heap {
+		if p := o.pos.Get(h.Key); p != 0 {
+			h.Count += o.heap[p-1].Count
+			h.Error += o.heap[p-1].Error
+		} else {
+			h.Count += oMin
+			h.Error += oMin
+		}
+		all = append(all, h)
+	}
+	for _, h := range o.heap {
+		if !t.pos.Exists(h.Key) {
+			h.Count += tMin
+			h.Error += tMin
+			all = append(all, h)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Count > all[j].Count })
+	if len(all) > t.k {
+		all = all[:t.k]
+	}
+	total := t.total + o.total
+	t.Clear()
+	t.total = total
+	// sorted descending, the reversed slice is a valid min-heap
+	for i := len(all) - 1; i >= 0; i-- {
+		t.heap = append(t.heap, all[i])
+		t.pos.Put(all[i].Key, uint(len(t.heap)))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package hash
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// topKeys returns n keys with largest counts
+func topKeys(counts map[uint]uint, n int) []uint {
+	keys := make([]uint, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] > counts[keys[j]] })
+	return keys[:n]
+}
+
+func checkHeavyHitters(t *testing.T, h *HeavyHitters, counts map[uint]uint) {
+	top := h.Top(10)
+	assert.Len(t, top, 10)
+	for i, k := range topKeys(counts, 10) {
+		assert.Equal(t, k, top[i].Key)
+	}
+	for _, e := range h.Top(h.Len()) {
+		n := counts[e.Key]
+		assert.True(t, e.Count >= n && e.Count-e.Error <= n, "%v real %d", e, n)
+	}
+	// every key above Total/k is monitored
+	threshold := h.Total() / uint(h.k)
+	for k, n := range counts {
+		if n > threshold {
+			assert.True(t, h.pos.Exists(k))
+		}
+	}
+	for _, e := range h.Guaranteed(threshold) {
+		assert.True(t, counts[e.Key] > threshold)
+	}
+}
+
+func Test_HeavyHitters(t *testing.T) {
+	keys, counts := zipfStream(500000, 3)
+	h := NewHeavyHitters(100)
+	for _, k := range keys {
+		h.Add(k, 1)
+	}
+	assert.Equal(t, 100, h.Len())
+	assert.EqualValues(t, len(keys), h.Total())
+	checkHeavyHitters(t, h, counts)
+	assert.True(t, len(h.Guaranteed(h.Total()/100)) > 0)
+	assert.Equal(t, h.heap[0].Count, h.Estimate(1<<40))
+	h.Clear()
+	assert.Equal(t, 0, h.Len())
+	assert.EqualValues(t, 0, h.Estimate(1))
+	assert.Panics(t, func() { NewHeavyHitters(0) })
+}
+
+func Test_HeavyHittersMerge(t *testing.T) {
+	keys, counts := zipfStream(400000, 4)
+	shards := []*HeavyHitters{NewHeavyHitters(100), NewHeavyHitters(100), NewHeavyHitters(100)}
+	for i, k := range keys {
+		shards[i%3].Add(k, 1)
+	}
+	assert.NoError(t, shards[0].Merge(shards[1]))
+	assert.NoError(t, shards[0].Merge(shards[2]))
+	assert.EqualValues(t, len(keys), shards[0].Total())
+	checkHeavyHitters(t, shards[0], counts)
+	for i := 1; i < shards[0].Len(); i++ {
+		p := (i - 1) / 2
+		assert.True(t, shards[0].heap[p].Count <= shards[0].heap[i].Count)
+	}
+	assert.Equal(t, SketchMismatchError, shards[0].Merge(NewHeavyHitters(10)))
+}
@@ -0,0 +1,316 @@
+package hash
+
+//
+// HyperLogLog cardinality estimator.
+//
+// Hash code of a key is mix64 of uintHashCode (bytesHashCode for byte keys). Top p bits select
+// one of 2^p registers, the register keeps maximal rank (leading zeros + 1) of the remaining bits.
+// Standard error is 1.04/sqrt(2^p): 1.6% at p=12 (3KB), 0.8% at p=14 (13KB).
+//
+// Like HLL++, small cardinalities use sparse representation: sorted list of (index, rank) pairs
+// at precision hllSparseP = 25, kept while it is smaller than the registers. Unsorted additions
+// are buffered and merged into the list in batches. Dense registers take 6 bits, 10 per word.
+//
+// HLL++ corrects bias of the raw estimate at small and intermediate cardinalities with empirical
+// tables, switching to linear counting below a threshold. Instead, the estimate is computed by
+// the improved estimator of O. Ertl ("New cardinality estimation algorithms for HyperLogLog
+// sketches", 2017), which removes the same bias analytically and needs neither tables nor
+// thresholds. It is applied to sparse representation as well, treating it as 2^25 registers.
+//
+// Sketches with the same precision can be merged, merging sparse and dense ones is fine.
+// Binary encoding is little-endian and does not depend on the platform.
+//
+
+// prefix: hll
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	hllMinP         = 4
+	hllMaxP         = 18
+	hllSparseP      = 25
+	hllRegBits      = 6
+	hllRegsPerWord  = 64 / hllRegBits
+	hllRegMask      = 1<<hllRegBits - 1
+	hllSparseBuffer = 256
+)
+
+var hyperLogLogMagic = [4]byte{'G', 'H', 'L', 'L'}
+
+type HyperLogLog struct {
+	p      uint
+	sparse []uint32 // index << hllRegBits | rank at hllSparseP, sorted by index, one pair per index
+	buf    []uint32 // unsorted sparse additions
+	regs   []uint64 // dense registers, nil in sparse mode
+}
+
+// NewHyperLogLog creates estimator with 2^precision registers, precision is from 4 to 18
+func NewHyperLogLog(precision uint) *HyperLogLog {
+	if precision < hllMinP || precision > hllMaxP {
+		panic("invalid precision")
+	}
+	return &HyperLogLog{p: precision}
+}
+
+// hllRank returns rank of bits w, a word with valid bits at the top
+func hllRank(w uint64, valid uint) uint {
+	lz := uint(bits.LeadingZeros64(w))
+	if lz > valid {
+		lz = valid
+	}
+	return lz + 1
+}
+
+func (s *HyperLogLog) denseWords() int {
+	return (1<<s.p + hllRegsPerWord - 1) / hllRegsPerWord
+}
+
+func (s *HyperLogLog) reg(i uint) uint {
+	return uint(s.regs[i/hllRegsPerWord]>>(i%hllRegsPerWord*hllRegBits)) & hllRegMask
+}
+
+// setMax raises register i to rank r
+func (s *HyperLogLog) setMax(i, r uint) {
+	w := &s.regs[i/hllRegsPerWord]
+	shift := i % hllRegsPerWord * hllRegBits
+	if uint(*w>>shift)&hllRegMask < r {
+		*w = *w&^(hllRegMask<<shift) | uint64(r)<<shift
+	}
+}
+
+func (s *HyperLogLog) add(h uint) {
+	h64 := uint64(mix64(h))
+	if s.regs != nil {
+		s.setMax(uint(h64>>(64-s.p)), hllRank(h64<<s.p, 64-s.p))
+		return
+	}
+	idx := uint32(h64 >> (64 - hllSparseP))
+	s.buf = append(s.buf, idx<<hllRegBits|uint32(hllRank(h64<<hllSparseP, 64-hllSparseP)))
+	if len(s.buf) == hllSparseBuffer {
+		s.flush()
+	}
+}
+
+// flush merges buffered additions into sparse list, converting to dense registers when
+// the list outgrows them
+func (s *HyperLogLog) flush() {
+	if len(s.buf) == 0 {
+		return
+	}
+	sort.Slice(s.buf, func(i, j int) bool { return s.buf[i] < s.buf[j] })
+	s.sparse = hllMergeSparse(s.sparse, s.buf)
+	s.buf = s.buf[:0]
+	if len(s.sparse)*4 > s.denseWords()*8 {
+		s.toDense()
+	}
+}
+
+// hllMergeSparse merges sorted lists keeping maximal rank per index.
+// Entries of the same index are sorted by rank, so the last one wins.
+func hllMergeSparse(a, b []uint32) []uint32 {
+	r := make([]uint32, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		var e uint32
+		if len(b) == 0 || (len(a) > 0 && a[0] < b[0]) {
+			e, a = a[0], a[1:]
+		} else {
+			e, b = b[0], b[1:]
+		}
+		if n := len(r); n > 0 && r[n-1]>>hllRegBits == e>>hllRegBits {
+			r[n-1] = e
+		} else {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+// toDense converts sparse list to registers
+func (s *HyperLogLog) toDense() {
+	s.regs = make([]uint64, s.denseWords())
+	low := hllSparseP - s.p
+	for _, e := range s.sparse {
+		idx, rank := uint(e>>hllRegBits), uint(e&hllRegMask)
+		// index bits below p belong to the rank bits at precision p
+		if l := idx & (1<<low - 1); l != 0 {
+			rank = low - uint(bits.Len(l)) + 1
+		} else {
+			rank += low
+		}
+		s.setMax(idx>>low, rank)
+	}
+	s.sparse, s.buf = nil, nil
+}
+
+func (s *HyperLogLog) Add(key uint) {
+	s.add(uintHashCode(key))
+}
+
+func (s *HyperLogLog) AddBytes(key []byte) {
+	s.add(bytesHashCode(key))
+}
+
+// Precision returns base 2 logarithm of number of registers
+func (s *HyperLogLog) Precision() uint {
+	return s.p
+}
+
+// IsSparse reports whether the sketch uses sparse representation
+func (s *HyperLogLog) IsSparse() bool {
+	return s.regs == nil
+}
+
+// Count returns estimated number of distinct keys added
+func (s *HyperLogLog) Count() uint {
+	s.flush()
+	var hist [64 + 2]uint
+	var p uint
+	if s.regs != nil {
+		p = s.p
+		for i := uint(0); i < 1<<p; i++ {
+			hist[s.reg(i)]++
+		}
+	} else {
+		p = hllSparseP
+		hist[0] = 1<<p - uint(len(s.sparse))
+		for _, e := range s.sparse {
+			hist[e&hllRegMask]++
+		}
+	}
+	return uint(math.Round(hllEstimate(hist[:64-p+2], 1<<p)))
+}
+
+// hllEstimate is the improved estimator of Ertl for histogram of m registers by rank
+func hllEstimate(hist []uint, m uint) float64 {
+	if hist[0] == m {
+		return 0
+	}
+	q := len(hist) - 2
+	fm := float64(m)
+	z := fm * hllTau(1-float64(hist[q+1])/fm)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + float64(hist[k]))
+	}
+	z += fm * hllSigma(float64(hist[0])/fm)
+	return fm * fm / (2 * math.Ln2 * z)
+}
+
+func hllSigma(x float64) float64 {
+	y, z := 1.0, x
+	for {
+		x *= x
+		next := z + x*y
+		y += y
+		if next == z {
+			return z
+		}
+		z = next
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// Merge adds keys of o to s. Sketches must have the same precision.
+func (s *HyperLogLog) Merge(o *HyperLogLog) error {
+	if s.p != o.p {
+		return SketchMismatchError
+	}
+	s.flush()
+	o.flush()
+	switch {
+	case o.regs == nil:
+		if s.regs == nil {
+			s.sparse = hllMergeSparse(s.sparse, o.sparse)
+			s.buf = s.buf[:0]
+			if len(s.sparse)*4 > s.denseWords()*8 {
+				s.toDense()
+			}
+			return nil
+		}
+		t := HyperLogLog{p: o.p, sparse: o.sparse}
+		t.toDense()
+		o = &t
+	case s.regs == nil:
+		s.toDense()
+	}
+	for i := uint(0); i < 1<<s.p; i++ {
+		s.setMax(i, o.reg(i))
+	}
+	return nil
+}
+
+func (s *HyperLogLog) Clear() {
+	s.sparse, s.buf, s.regs = nil, nil, nil
+}
+
+func (s *HyperLogLog) MarshalBinary() ([]byte, error) {
+	s.flush()
+	if s.regs != nil {
+		return sketchEncode(hyperLogLogMagic, []uint64{uint64(s.p), 1}, s.regs), nil
+	}
+	words := make([]uint64, (len(s.sparse)+1)/2)
+	for i, e := range s.sparse {
+		words[i/2] |= uint64(e) << (i % 2 * 32)
+	}
+	return sketchEncode(hyperLogLogMagic, []uint64{uint64(s.p), 0}, words), nil
+}
+
+func (s *HyperLogLog) UnmarshalBinary(data []byte) error {
+	params, words, err := sketchDecode(data, hyperLogLogMagic, 2)
+	if err != nil {
+		return err
+	}
+	t := HyperLogLog{p: uint(params[0])}
+	if t.p < hllMinP || t.p > hllMaxP || params[1] > 1 {
+		return SnapshotFormatError
+	}
+	if params[1] == 1 {
+		if len(words) != t.denseWords() {
+			return SnapshotFormatError
+		}
+		t.regs = words
+		for i := uint(0); i < 1<<t.p; i++ {
+			if t.reg(i) > 64-t.p+1 {
+				return SnapshotFormatError
+			}
+		}
+	} else {
+		t.sparse = make([]uint32, 0, 2*len(words))
+		for i, w := range words {
+			for _, e := range []uint32{uint32(w), uint32(w >> 32)} {
+				if e == 0 && i == len(words)-1 {
+					break
+				}
+				// indexes must grow, ranks fit 64-hllSparseP bits
+				if n := len(t.sparse); (n > 0 && e>>hllRegBits <= t.sparse[n-1]>>hllRegBits) ||
+					e&hllRegMask == 0 || e&hllRegMask > 64-hllSparseP+1 {
+					return SnapshotFormatError
+				}
+				t.sparse = append(t.sparse, e)
+			}
+		}
+		if len(t.sparse)*4 > t.denseWords()*8 {
+			return SnapshotFormatError
+		}
+	}
+	*s = t
+	return nil
+}
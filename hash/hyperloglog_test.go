@@ -0,0 +1,104 @@
+package hash
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hllError(s *HyperLogLog, n uint) float64 {
+	return math.Abs(float64(s.Count())-float64(n)) / float64(n)
+}
+
+func Test_HyperLogLog(t *testing.T) {
+	s := NewHyperLogLog(14)
+	assert.EqualValues(t, 0, s.Count())
+	var n uint
+	for _, limit := range []uint{10, 100, 1000, 10000, 100000, 1000000} {
+		for ; n < limit; n++ {
+			s.Add(n * 3)
+			s.Add(n * 3) // duplicates don't count
+		}
+		assert.True(t, hllError(s, n) < 0.025, "%d: %d", n, s.Count())
+		if n <= 1000 {
+			assert.True(t, s.IsSparse())
+			assert.True(t, hllError(s, n) < 0.002, "sparse %d: %d", n, s.Count())
+		}
+	}
+	assert.False(t, s.IsSparse())
+	s.Clear()
+	assert.EqualValues(t, 0, s.Count())
+
+	b := NewHyperLogLog(12)
+	for i := 0; i < 50000; i++ {
+		b.AddBytes([]byte("key" + strconv.Itoa(i)))
+	}
+	assert.True(t, hllError(b, 50000) < 0.05, "%d", b.Count())
+	assert.Panics(t, func() { NewHyperLogLog(3) })
+	assert.Panics(t, func() { NewHyperLogLog(19) })
+}
+
+func Test_HyperLogLogMerge(t *testing.T) {
+	for _, n := range []uint{500, 200000} {
+		// workers see overlapping halves
+		a, b, all := NewHyperLogLog(14), NewHyperLogLog(14), NewHyperLogLog(14)
+		for i := uint(0); i < n; i++ {
+			all.Add(i)
+			if i < n*3/5 {
+				a.Add(i)
+			}
+			if i >= n*2/5 {
+				b.Add(i)
+			}
+		}
+		assert.NoError(t, a.Merge(b))
+		assert.Equal(t, all.Count(), a.Count())
+		assert.Equal(t, all.IsSparse(), a.IsSparse())
+	}
+	// sparse into dense and dense into sparse
+	d, sp := NewHyperLogLog(10), NewHyperLogLog(10)
+	for i := uint(0); i < 100000; i++ {
+		d.Add(i)
+	}
+	for i := uint(100000); i < 100050; i++ {
+		sp.Add(i)
+	}
+	want := NewHyperLogLog(10)
+	assert.NoError(t, want.Merge(d))
+	assert.NoError(t, want.Merge(sp))
+	assert.NoError(t, sp.Merge(d))
+	assert.False(t, sp.IsSparse())
+	assert.Equal(t, want.Count(), sp.Count())
+	assert.NoError(t, d.Merge(sp))
+	assert.Equal(t, want.Count(), d.Count())
+	assert.Equal(t, SketchMismatchError, d.Merge(NewHyperLogLog(11)))
+}
+
+func Test_HyperLogLogMarshal(t *testing.T) {
+	for _, n := range []uint{0, 1, 777, 100000} {
+		s := NewHyperLogLog(12)
+		for i := uint(0); i < n; i++ {
+			s.Add(i)
+		}
+		data, err := s.MarshalBinary()
+		assert.NoError(t, err)
+		var r HyperLogLog
+		assert.NoError(t, r.UnmarshalBinary(data))
+		assert.Equal(t, s.Count(), r.Count())
+		assert.Equal(t, s.IsSparse(), r.IsSparse())
+		again, _ := r.MarshalBinary()
+		assert.Equal(t, data, again)
+		r.Add(n + 1)
+		assert.True(t, r.Count() >= s.Count())
+	}
+	// encoding is stable
+	s := NewHyperLogLog(4)
+	s.Add(1)
+	data, _ := s.MarshalBinary()
+	assert.Equal(t, "47484c4c01000000040000000000000000000000000000008150eb1700000000fe80a30c", hex.EncodeToString(data))
+	var r HyperLogLog
+	assert.Equal(t, SnapshotFormatError, r.UnmarshalBinary(data[:8]))
+}
@@ -0,0 +1,9 @@
+// Package genmaptest checks code generated by cmd/genmap outside of package hash
+package genmaptest
+
+//go:generate go run ../../cmd/genmap -name PointMap -key int64 -value Point -testvalue Point{X:int32(i),Y:-int32(i)} -test
+
+// Point is a small struct value
+type Point struct {
+	X, Y int32
+}
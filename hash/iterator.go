@@ -0,0 +1,38 @@
+package hash
+
+//
+// Iterators of hash containers are fail-fast: any structural change of the container
+// (adding or removing keys, splits, merges, Clear, Compact) not made through the iterator itself
+// makes the next access to the iterator panic with ConcurrentModificationError.
+// Updating value of an existing key is not a structural change.
+//
+
+import "errors"
+
+var ConcurrentModificationError = errors.New("container modified during iteration")
+
+// appendWrapped appends to skip keys from the start of bucket slots which may be moved
+// behind iteration position pos by backward shift deletion of slot pos.
+// It happens only when the probe cluster starting at pos runs up to the last slot and wraps around.
+func appendWrapped(skip []uint, pos int, key func(i int) uint) []uint {
+	for i := pos + 1; i < entriesPerHashBucket; i++ {
+		if key(i) == 0 {
+			return skip
+		}
+	}
+	for i := 0; i < pos && key(i) != 0; i++ {
+		skip = append(skip, key(i))
+	}
+	return skip
+}
+
+// skipped removes key from skip and reports whether it was there
+func skipped(skip []uint, key uint) ([]uint, bool) {
+	for i, k := range skip {
+		if k == key {
+			skip[i] = skip[len(skip)-1]
+			return skip[:len(skip)-1], true
+		}
+	}
+	return skip, false
+}
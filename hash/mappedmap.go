@@ -0,0 +1,422 @@
+package hash
+
+//
+// MappedUintMap
+// UintMap living in a memory mapped file. Opening takes no load time and the OS page cache
+// keeps only the touched buckets in memory.
+//
+// File layout, all words in native byte order:
+//	page 0            header
+//	pages 1..pages    buckets, one uumBucket per page
+//	after the buckets directory, one uint32 page number per directory slot
+// Directory and header are written by Sync, modifications make the file dirty until then,
+// and a dirty file can't be opened: changes made after the last Sync are lost on crash.
+// The first modification after Sync writes the dirty header through to disk before any
+// bucket page changes, so a crash can't leave a clean header over modified buckets.
+// The file is mapped with extra address space reserved beyond its end, so the file grows by
+// ftruncate only and bucket pointers stay valid. When the reserve is exhausted the file is
+// remapped before a modification starts and the directory is rebased to the new address.
+//
+
+// prefix: mm
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+)
+
+var (
+	MappedFileFormatError   = errors.New("invalid mapped map file")
+	MappedFileDirtyError    = errors.New("mapped map file was not synced")
+	MappedNotSupportedError = errors.New("mapped maps are not supported on this platform")
+)
+
+// msync of mapped memory, replaced by tests simulating a crash
+var mmSync = syncMapped
+
+const (
+	mmPageSize = 4096
+	mmVersion  = 1
+
+	// pages reserved in address space before a modification, enough for the longest split chain
+	mmSplitReserve = 2 * bitsPerHashCode
+
+	// minimal address space reserved for the mapping
+	mmMinMapSize = 64 << 20
+)
+
+var mmMagic = [4]byte{'G', 'U', 'M', 'F'}
+
+type mmHeader struct {
+	magic     [4]byte
+	version   uint32
+	clean     uint64 // 1 if header and directory match the buckets
+	dirBits   uint64
+	pages     uint64 // number of bucket pages
+	count     uint64
+	hasZero   uint64
+	zeroValue uint64
+}
+
+// MappedOptions are options of OpenMappedUintMap
+type MappedOptions struct {
+	ReadOnly    bool // map file for reading, several processes may share it while nobody writes it
+	InitDirBits uint // initial directory bits of a new file, default if 0
+}
+
+type MappedUintMap struct {
+	m        UintMap
+	f        *os.File
+	mem      []byte // mapping, longer than the file
+	size     int    // file size
+	readOnly bool
+	dirty    bool
+	pages    uint   // number of bucket pages
+	free     []uint // pages of released buckets
+}
+
+// OpenMappedUintMap opens map file at path, creating new one unless opened read only.
+// Map must be closed by Close.
+func OpenMappedUintMap(path string, opts MappedOptions) (*MappedUintMap, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if opts.ReadOnly {
+		flags = os.O_RDONLY
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	mm := &MappedUintMap{f: f, readOnly: opts.ReadOnly}
+	if err = mm.open(opts); err != nil {
+		if mm.mem != nil {
+			unmapFile(mm.mem)
+		}
+		f.Close()
+		return nil, err
+	}
+	return mm, nil
+}
+
+func (mm *MappedUintMap) open(opts MappedOptions) error {
+	if err := lockFile(mm.f, !mm.readOnly); err != nil {
+		return err
+	}
+	fi, err := mm.f.Stat()
+	if err != nil {
+		return err
+	}
+	mm.size = int(fi.Size())
+	if mm.size == 0 && !mm.readOnly {
+		return mm.create(opts)
+	}
+	if mm.size < mmPageSize {
+		return MappedFileFormatError
+	}
+	if err = mm.remap(mm.size); err != nil {
+		return err
+	}
+	h := mm.header()
+	if h.magic != mmMagic || h.version != mmVersion {
+		return MappedFileFormatError
+	}
+	if h.clean != 1 {
+		return MappedFileDirtyError
+	}
+	return mm.load(h)
+}
+
+func (mm *MappedUintMap) create(opts MappedOptions) error {
+	bits := opts.InitDirBits
+	if bits == 0 {
+		bits = defaultHashDirBits
+	}
+	if bits < 2 || bits > 24 {
+		return errors.New("invalid init bits")
+	}
+	if err := mm.truncate(mmPageSize); err != nil {
+		return err
+	}
+	if err := mm.remap(mmPageSize); err != nil {
+		return err
+	}
+	h := mm.header()
+	h.magic = mmMagic
+	h.version = mmVersion
+	mm.m.alloc = mm
+	mm.m.init(bits)
+	return mm.Sync()
+}
+
+// load builds directory from the file, verifying its structure
+func (mm *MappedUintMap) load(h *mmHeader) error {
+	dirBits := uint(h.dirBits)
+	pages := uint(h.pages)
+	if dirBits > 32 || pages > uint(mm.size)/mmPageSize {
+		return MappedFileFormatError
+	}
+	dirOff := (1 + pages) * mmPageSize
+	dirLen := uint(1) << dirBits
+	if dirOff+dirLen*4 > uint(mm.size) {
+		return MappedFileFormatError
+	}
+	disk := (*[1 << 32]uint32)(unsafe.Pointer(&mm.mem[dirOff]))[:dirLen:dirLen]
+	used := make([]bool, pages+1)
+	dir := make([]*uumBucket, dirLen)
+	var count uint
+	for i := uint(0); i < dirLen; {
+		page := uint(disk[i])
+		if page == 0 || page > pages || used[page] {
+			return MappedFileFormatError
+		}
+		used[page] = true
+		b := mm.bucketAt(page)
+		// only the structure is checked, entries are not touched to keep opening cheap
+		span, ok := bucketSpan(dirBits, b.bits, i)
+		if !ok || b.count > entriesPerHashBucket {
+			return MappedFileFormatError
+		}
+		for j := i; j < i+span; j++ {
+			if uint(disk[j]) != page {
+				return MappedFileFormatError
+			}
+			dir[j] = b
+		}
+		count += b.count
+		i += span
+	}
+	if h.hasZero > 1 || count+uint(h.hasZero) != uint(h.count) {
+		return MappedFileFormatError
+	}
+	for page := uint(1); page <= pages; page++ {
+		if !used[page] {
+			mm.free = append(mm.free, page)
+		}
+	}
+	mm.pages = pages
+	m := &mm.m
+	m.alloc = mm
+	m.dirBits = dirBits
+	m.dir = dir
+	m.count = uint(h.count)
+	m.zeroEntryAssigned = h.hasZero == 1
+	m.zeroEntry.value = uint(h.zeroValue)
+	return nil
+}
+
+func (mm *MappedUintMap) header() *mmHeader {
+	return (*mmHeader)(unsafe.Pointer(&mm.mem[0]))
+}
+
+func (mm *MappedUintMap) bucketAt(page uint) *uumBucket {
+	return (*uumBucket)(unsafe.Pointer(&mm.mem[page*mmPageSize]))
+}
+
+func (mm *MappedUintMap) pageOf(b *uumBucket) uint {
+	return uint(uintptr(unsafe.Pointer(b))-uintptr(unsafe.Pointer(&mm.mem[0]))) / mmPageSize
+}
+
+// truncate grows the file to at least size bytes
+func (mm *MappedUintMap) truncate(size int) error {
+	if size <= mm.size {
+		return nil
+	}
+	if grow := mm.size + mm.size/4; size < grow {
+		size = (grow + mmPageSize - 1) &^ (mmPageSize - 1)
+	}
+	if err := mm.f.Truncate(int64(size)); err != nil {
+		return err
+	}
+	mm.size = size
+	return nil
+}
+
+// remap maps the file with address space for at least size bytes and rebases the directory
+func (mm *MappedUintMap) remap(size int) error {
+	length := size
+	if !mm.readOnly {
+		length = 2 * size
+		if length < mmMinMapSize {
+			length = mmMinMapSize
+		}
+	}
+	mem, err := mapFile(mm.f, length, !mm.readOnly)
+	if err != nil {
+		return err
+	}
+	old := mm.mem
+	if old != nil {
+		for i, b := range mm.m.dir {
+			if i > 0 && b == mm.m.dir[i-1] {
+				mm.m.dir[i] = mm.m.dir[i-1]
+			} else {
+				mm.m.dir[i] = (*uumBucket)(unsafe.Pointer(&mem[mm.pageOf(b)*mmPageSize]))
+			}
+		}
+		unmapFile(old)
+	}
+	mm.mem = mem
+	return nil
+}
+
+// modify prepares the map for a modification
+func (mm *MappedUintMap) modify() {
+	if mm.readOnly {
+		panic("modification of read only mapped map")
+	}
+	if mm.mem == nil {
+		panic("mapped map is closed")
+	}
+	need := int(mm.pages+1+mmSplitReserve) * mmPageSize
+	if need > len(mm.mem) {
+		if err := mm.remap(need); err != nil {
+			panic(err)
+		}
+	}
+	if !mm.dirty {
+		mm.dirty = true
+		mm.header().clean = 0
+		if err := mmSync(mm.mem[:mmPageSize]); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// bucketAllocator implementation
+
+func (mm *MappedUintMap) bucket() unsafe.Pointer {
+	var page uint
+	if n := len(mm.free); n > 0 {
+		page = mm.free[n-1]
+		mm.free = mm.free[:n-1]
+	} else {
+		mm.pages++
+		page = mm.pages
+		if err := mm.truncate(int(page+1) * mmPageSize); err != nil {
+			panic(err)
+		}
+	}
+	return unsafe.Pointer(mm.bucketAt(page))
+}
+
+func (mm *MappedUintMap) freeBucket(p unsafe.Pointer) {
+	mm.free = append(mm.free, mm.pageOf((*uumBucket)(p)))
+}
+
+func (mm *MappedUintMap) dir(n int, dir unsafe.Pointer) {
+	// directory lives on Go heap, the file gets it at Sync
+	*(*[]*uumBucket)(dir) = make([]*uumBucket, n)
+}
+
+func (mm *MappedUintMap) freeDir(p unsafe.Pointer) {
+}
+
+func (mm *MappedUintMap) release() {
+	mm.pages = 0
+	mm.free = mm.free[:0]
+}
+
+// Sync writes directory and header and flushes the file to disk
+func (mm *MappedUintMap) Sync() error {
+	if mm.readOnly || (!mm.dirty && mm.header().clean == 1) {
+		return nil
+	}
+	m := &mm.m
+	dirOff := int(mm.pages+1) * mmPageSize
+	end := dirOff + len(m.dir)*4
+	if err := mm.truncate(end); err != nil {
+		return err
+	}
+	if end > len(mm.mem) {
+		if err := mm.remap(end); err != nil {
+			return err
+		}
+	}
+	disk := (*[1 << 32]uint32)(unsafe.Pointer(&mm.mem[dirOff]))[:len(m.dir):len(m.dir)]
+	for i, b := range m.dir {
+		disk[i] = uint32(mm.pageOf(b))
+	}
+	h := mm.header()
+	h.clean = 0
+	h.dirBits = uint64(m.dirBits)
+	h.pages = uint64(mm.pages)
+	h.count = uint64(m.count)
+	h.hasZero = 0
+	if m.zeroEntryAssigned {
+		h.hasZero = 1
+	}
+	h.zeroValue = uint64(m.zeroEntry.value)
+	if err := mmSync(mm.mem[:mm.size]); err != nil {
+		return err
+	}
+	// the file is clean only once everything else is on disk
+	h.clean = 1
+	if err := mmSync(mm.mem[:mmPageSize]); err != nil {
+		return err
+	}
+	mm.dirty = false
+	return nil
+}
+
+// Close syncs the map and releases the file
+func (mm *MappedUintMap) Close() error {
+	if mm.mem == nil {
+		return errors.New("mapped map is already closed")
+	}
+	err := mm.Sync()
+	if e := unmapFile(mm.mem); err == nil {
+		err = e
+	}
+	mm.mem = nil
+	mm.m.dir = nil
+	if e := mm.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Map methods
+
+func (mm *MappedUintMap) Get(key uint) uint {
+	return mm.m.Get(key)
+}
+func (mm *MappedUintMap) Exists(key uint) bool {
+	return mm.m.Exists(key)
+}
+func (mm *MappedUintMap) Put(key, value uint) {
+	mm.modify()
+	mm.m.Put(key, value)
+}
+func (mm *MappedUintMap) Inc(key, delta uint) {
+	mm.modify()
+	mm.m.Inc(key, delta)
+}
+func (mm *MappedUintMap) Dec(key, delta uint) {
+	mm.modify()
+	mm.m.Dec(key, delta)
+}
+func (mm *MappedUintMap) Delete(key uint) bool {
+	mm.modify()
+	return mm.m.Delete(key)
+}
+func (mm *MappedUintMap) Len() uint {
+	return mm.m.Len()
+}
+func (mm *MappedUintMap) Do(f func(uint, uint)) {
+	mm.m.Do(f)
+}
+
+// Iterator returns iterator over the map. Modifications of the map make it panic as usual.
+func (mm *MappedUintMap) Iterator() UintMapIterator {
+	return mm.m.Iterator()
+}
+func (mm *MappedUintMap) Clear() {
+	mm.modify()
+	mm.m.Clear()
+}
+
+// Compact merges underfilled buckets, released pages are reused by later splits
+func (mm *MappedUintMap) Compact() {
+	mm.modify()
+	mm.m.Compact()
+}
@@ -0,0 +1,157 @@
+// +build !windows
+
+package hash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MappedUintMap(t *testing.T) {
+	const n = 200000
+	path := filepath.Join(t.TempDir(), "map")
+	mm, err := OpenMappedUintMap(path, MappedOptions{InitDirBits: 2})
+	assert.NoError(t, err)
+	for i := uint(0); i < n; i++ {
+		mm.Put(i, i+1)
+	}
+	mm.Inc(7, 10)
+	assert.EqualValues(t, n, mm.Len())
+	assert.NoError(t, mm.Close())
+
+	mm, err = OpenMappedUintMap(path, MappedOptions{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, n, mm.Len())
+	// growing the mapping rebases the directory
+	assert.NoError(t, mm.remap(len(mm.mem)+mmPageSize))
+	assert.Equal(t, uint(1), mm.Get(0))
+	assert.Equal(t, uint(18), mm.Get(7))
+	for i := uint(8); i < n; i++ {
+		if mm.Get(i) != i+1 {
+			t.Fatalf("wrong value of %d: %d", i, mm.Get(i))
+		}
+	}
+	for i := uint(0); i < n; i++ {
+		if i%10 != 0 {
+			mm.Delete(i)
+		}
+	}
+	mm.Compact()
+	pages := mm.pages
+	free := len(mm.free)
+	assert.True(t, free > 0)
+	// released pages are reused before the file grows
+	for i := uint(0); i < n/2; i++ {
+		mm.Put(n+i, i)
+	}
+	assert.Equal(t, pages, mm.pages)
+	assert.True(t, len(mm.free) < free)
+	assert.NoError(t, mm.Close())
+
+	mm, err = OpenMappedUintMap(path, MappedOptions{ReadOnly: true})
+	assert.NoError(t, err)
+	assert.EqualValues(t, n/10+n/2, mm.Len())
+	mm.Do(func(k, v uint) {
+		if k < n {
+			assert.Equal(t, uint(0), k%10)
+			assert.Equal(t, k+1, v)
+		} else {
+			assert.Equal(t, k-n, v)
+		}
+	})
+	assert.Panics(t, func() { mm.Put(1, 1) })
+	assert.NoError(t, mm.Close())
+	assert.Error(t, mm.Close())
+}
+
+func Test_MappedUintMapDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map")
+	mm, err := OpenMappedUintMap(path, MappedOptions{})
+	assert.NoError(t, err)
+	mm.Put(1, 2)
+	assert.NoError(t, mm.Sync())
+	mm.Put(3, 4)
+	// crash: the file is dropped without Sync
+	unmapFile(mm.mem)
+	mm.f.Close()
+
+	_, err = OpenMappedUintMap(path, MappedOptions{})
+	assert.Equal(t, MappedFileDirtyError, err)
+	_, err = OpenMappedUintMap(path, MappedOptions{ReadOnly: true})
+	assert.Equal(t, MappedFileDirtyError, err)
+}
+
+func Test_MappedUintMapCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map")
+	// header page as it was last written through to disk
+	var header []byte
+	defer func() { mmSync = syncMapped }()
+	mmSync = func(mem []byte) error {
+		header = append(header[:0], mem[:mmPageSize]...)
+		return syncMapped(mem)
+	}
+
+	mm, err := OpenMappedUintMap(path, MappedOptions{})
+	assert.NoError(t, err)
+	mm.Put(1, 2)
+	assert.NoError(t, mm.Sync())
+	mm.Put(3, 4)
+	// crash: the kernel has written back the bucket pages but nothing was synced since
+	unmapFile(mm.mem)
+	f := mm.f
+	_, err = f.WriteAt(header, 0)
+	assert.NoError(t, err)
+	f.Close()
+
+	_, err = OpenMappedUintMap(path, MappedOptions{})
+	assert.Equal(t, MappedFileDirtyError, err)
+}
+
+func Test_MappedUintMapFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map")
+	assert.NoError(t, os.WriteFile(path, make([]byte, 100), 0666))
+	_, err := OpenMappedUintMap(path, MappedOptions{})
+	assert.Equal(t, MappedFileFormatError, err)
+
+	path = filepath.Join(dir, "map2")
+	mm, err := OpenMappedUintMap(path, MappedOptions{})
+	assert.NoError(t, err)
+	mm.Put(5, 6)
+	assert.NoError(t, mm.Close())
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte("XXXX"), 0)
+	assert.NoError(t, err)
+	f.Close()
+	_, err = OpenMappedUintMap(path, MappedOptions{})
+	assert.Equal(t, MappedFileFormatError, err)
+
+	_, err = OpenMappedUintMap(filepath.Join(dir, "none"), MappedOptions{ReadOnly: true})
+	assert.Error(t, err)
+}
+
+func Test_MappedUintMapClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map")
+	mm, err := OpenMappedUintMap(path, MappedOptions{})
+	assert.NoError(t, err)
+	for i := uint(0); i < 10000; i++ {
+		mm.Put(i, i)
+	}
+	mm.Clear()
+	mm.Put(0, 9)
+	mm.Put(42, 1)
+	assert.NoError(t, mm.Close())
+
+	mm, err = OpenMappedUintMap(path, MappedOptions{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, mm.Len())
+	assert.Equal(t, uint(9), mm.Get(0))
+	assert.True(t, mm.Exists(0))
+	assert.Equal(t, uint(1), mm.Get(42))
+	assert.False(t, mm.Exists(1))
+	assert.NoError(t, mm.Close())
+}
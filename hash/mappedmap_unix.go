@@ -0,0 +1,38 @@
+// +build !windows
+
+package hash
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func mapFile(f *os.File, length int, writable bool) ([]byte, error) {
+	prot := syscall.PROT_READ
+	if writable {
+		prot |= syscall.PROT_WRITE
+	}
+	return syscall.Mmap(int(f.Fd()), 0, length, prot, syscall.MAP_SHARED)
+}
+
+func unmapFile(mem []byte) error {
+	return syscall.Munmap(mem)
+}
+
+func syncMapped(mem []byte) error {
+	_, _, e := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&mem[0])), uintptr(len(mem)), syscall.MS_SYNC)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// lockFile takes exclusive lock for writers or shared lock for readers
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+}
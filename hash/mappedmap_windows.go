@@ -0,0 +1,21 @@
+// +build windows
+
+package hash
+
+import "os"
+
+func mapFile(f *os.File, length int, writable bool) ([]byte, error) {
+	return nil, MappedNotSupportedError
+}
+
+func unmapFile(mem []byte) error {
+	return MappedNotSupportedError
+}
+
+func syncMapped(mem []byte) error {
+	return MappedNotSupportedError
+}
+
+func lockFile(f *os.File, exclusive bool) error {
+	return MappedNotSupportedError
+}
@@ -0,0 +1,317 @@
+package hash
+
+//
+// Off-heap storage of UintMap and UintSet.
+// Buckets contain no pointers, so they can live in memory allocated by md.VAlloc, invisible
+// to the garbage collector: it neither scans nor counts it for GC pacing. Directory holds
+// pointers to such buckets only and lives there as well. Memory is released by Free,
+// in debug builds a finalizer reports containers dropped without Free.
+// Containers generated by cmd/genmap use the same allocator through OffHeapStorage.
+//
+
+import (
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/pi/goal/debug"
+	"github.com/pi/goal/md"
+)
+
+type offHeapOption struct{}
+
+// OffHeap passed to NewUintMap or NewUintSet places buckets and directory outside of Go heap.
+// Such container must be released by Free.
+var OffHeap offHeapOption
+
+// size of memory chunks for buckets
+const offHeapChunkSize = 1 << 20
+
+// number of off-heap allocators collected without Free, counted in debug builds only
+var offHeapLeaks uint32
+
+// bucketAllocator places buckets and directory of UintMap or UintSet outside of Go heap
+type bucketAllocator interface {
+	bucket() unsafe.Pointer // uninitialized bucket memory
+	freeBucket(p unsafe.Pointer)
+	dir(n int, dir unsafe.Pointer) // stores new zeroed directory of n pointers into slice pointed by dir
+	freeDir(p unsafe.Pointer)      // p points to the first directory element
+	release()                      // releases all memory, allocator stays usable
+}
+
+type offHeapAllocator struct {
+	bucketSize uintptr
+	chunks     [][]byte           // memory of buckets
+	rest       []byte             // unused tail of the last chunk
+	free       []unsafe.Pointer   // released buckets
+	dirs       map[uintptr][]byte // memory of live directories
+}
+
+func newOffHeapAllocator(bucketSize uintptr) bucketAllocator {
+	a := &offHeapAllocator{bucketSize: bucketSize, dirs: make(map[uintptr][]byte)}
+	if debug.Enabled {
+		runtime.SetFinalizer(a, func(a *offHeapAllocator) {
+			if len(a.chunks) != 0 || len(a.dirs) != 0 {
+				atomic.AddUint32(&offHeapLeaks, 1)
+				debug.Log("off-heap container storage leaked: %d chunks, %d directories", len(a.chunks), len(a.dirs))
+			}
+		})
+	}
+	return a
+}
+
+func offHeapAlloc(size uint) []byte {
+	mem, err := md.VAlloc(size)
+	if err != nil {
+		panic(err)
+	}
+	return mem
+}
+
+func (a *offHeapAllocator) bucket() unsafe.Pointer {
+	if n := len(a.free); n > 0 {
+		p := a.free[n-1]
+		a.free = a.free[:n-1]
+		return p
+	}
+	if uintptr(len(a.rest)) < a.bucketSize {
+		mem := offHeapAlloc(offHeapChunkSize)
+		a.chunks = append(a.chunks, mem)
+		a.rest = mem
+	}
+	p := unsafe.Pointer(&a.rest[0])
+	a.rest = a.rest[a.bucketSize:]
+	return p
+}
+
+func (a *offHeapAllocator) freeBucket(p unsafe.Pointer) {
+	a.free = append(a.free, p)
+}
+
+func (a *offHeapAllocator) dir(n int, dir unsafe.Pointer) {
+	mem := offHeapAlloc(uint(n) * uint(unsafe.Sizeof(uintptr(0))))
+	a.dirs[uintptr(unsafe.Pointer(&mem[0]))] = mem
+	sh := (*reflect.SliceHeader)(dir)
+	sh.Data = uintptr(unsafe.Pointer(&mem[0]))
+	sh.Len = n
+	sh.Cap = n
+}
+
+func (a *offHeapAllocator) freeDir(p unsafe.Pointer) {
+	mem, ok := a.dirs[uintptr(p)]
+	if !ok {
+		panic("unknown off-heap directory")
+	}
+	delete(a.dirs, uintptr(p))
+	md.VFree(mem)
+}
+
+func (a *offHeapAllocator) release() {
+	for _, mem := range a.chunks {
+		md.VFree(mem)
+	}
+	for _, mem := range a.dirs {
+		md.VFree(mem)
+	}
+	a.chunks = nil
+	a.rest = nil
+	a.free = nil
+	a.dirs = make(map[uintptr][]byte)
+}
+
+// UintMap storage
+
+func (m *UintMap) newBucket(bits uint) *uumBucket {
+	if m.alloc == nil {
+		return &uumBucket{bits: bits}
+	}
+	b := (*uumBucket)(m.alloc.bucket())
+	*b = uumBucket{bits: bits}
+	return b
+}
+
+func (m *UintMap) freeBucket(b *uumBucket) {
+	if m.alloc != nil {
+		m.alloc.freeBucket(unsafe.Pointer(b))
+	}
+}
+
+func (m *UintMap) newDir(n int) (dir []*uumBucket) {
+	if m.alloc == nil {
+		return make([]*uumBucket, n)
+	}
+	m.alloc.dir(n, unsafe.Pointer(&dir))
+	return
+}
+
+func (m *UintMap) freeDir(dir []*uumBucket) {
+	if m.alloc != nil {
+		m.alloc.freeDir(unsafe.Pointer(&dir[0]))
+	}
+}
+
+// assign replaces content of m with content of heap map t, keeping storage kind of m
+func (m *UintMap) assign(t *UintMap) {
+	t.incremental = m.incremental
+	t.robinHood = m.robinHood
+	if m.alloc == nil {
+		*m = *t
+		return
+	}
+	m.alloc.release()
+	t.alloc = m.alloc
+	dir := t.newDir(len(t.dir))
+	for i, b := range t.dir {
+		if i > 0 && b == t.dir[i-1] {
+			dir[i] = dir[i-1]
+		} else {
+			dir[i] = t.newBucket(0)
+			*dir[i] = *b
+		}
+	}
+	t.dir = dir
+	*m = *t
+}
+
+// Free releases memory of the map. Off-heap map must be freed, the map can't be used afterwards.
+func (m *UintMap) Free() {
+	if m.alloc != nil {
+		m.alloc.release()
+	}
+	m.dir, m.growDir = nil, nil
+	m.count = 0
+	m.zeroEntryAssigned = false
+	m.mods++
+}
+
+// UintSet storage
+
+func (s *UintSet) newBucket(bits uint) *usBucket {
+	if s.alloc == nil {
+		return &usBucket{bits: bits}
+	}
+	b := (*usBucket)(s.alloc.bucket())
+	*b = usBucket{bits: bits}
+	return b
+}
+
+func (s *UintSet) freeBucket(b *usBucket) {
+	if s.alloc != nil {
+		s.alloc.freeBucket(unsafe.Pointer(b))
+	}
+}
+
+func (s *UintSet) newDir(n int) (dir []*usBucket) {
+	if s.alloc == nil {
+		return make([]*usBucket, n)
+	}
+	s.alloc.dir(n, unsafe.Pointer(&dir))
+	return
+}
+
+func (s *UintSet) freeDir(dir []*usBucket) {
+	if s.alloc != nil {
+		s.alloc.freeDir(unsafe.Pointer(&dir[0]))
+	}
+}
+
+// assign replaces content of s with content of heap set t, keeping storage kind of s
+func (s *UintSet) assign(t *UintSet) {
+	t.incremental = s.incremental
+	if s.alloc == nil {
+		*s = *t
+		return
+	}
+	s.alloc.release()
+	t.alloc = s.alloc
+	dir := t.newDir(len(t.dir))
+	for i, b := range t.dir {
+		if i > 0 && b == t.dir[i-1] {
+			dir[i] = dir[i-1]
+		} else {
+			dir[i] = t.newBucket(0)
+			*dir[i] = *b
+		}
+	}
+	t.dir = dir
+	*s = *t
+}
+
+// Free releases memory of the set. Off-heap set must be freed, the set can't be used afterwards.
+func (s *UintSet) Free() {
+	if s.alloc != nil {
+		s.alloc.release()
+	}
+	s.dir, s.growDir = nil, nil
+	s.count = 0
+	s.hasZero = false
+	s.mods++
+}
+
+func (m *UintMap) useOffHeap() {
+	m.alloc = newOffHeapAllocator(unsafe.Sizeof(uumBucket{}))
+}
+
+func (s *UintSet) useOffHeap() {
+	s.alloc = newOffHeapAllocator(unsafe.Sizeof(usBucket{}))
+}
+
+// OffHeapStorage places buckets and directories of containers generated by cmd/genmap
+// outside of Go heap, as OffHeap does for UintMap and UintSet
+type OffHeapStorage struct {
+	a *offHeapAllocator
+}
+
+// NewOffHeapStorage creates storage of buckets of the type of bucket, which must hold no pointers
+func NewOffHeapStorage(bucket interface{}) *OffHeapStorage {
+	t := reflect.TypeOf(bucket)
+	if hasPointers(t) {
+		panic("off-heap bucket " + t.String() + " holds pointers")
+	}
+	return &OffHeapStorage{newOffHeapAllocator(t.Size()).(*offHeapAllocator)}
+}
+
+// hasPointers reports whether values of type t may hold pointers
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Bucket returns uninitialized bucket memory
+func (s *OffHeapStorage) Bucket() unsafe.Pointer {
+	return s.a.bucket()
+}
+
+func (s *OffHeapStorage) FreeBucket(p unsafe.Pointer) {
+	s.a.freeBucket(p)
+}
+
+// Dir stores new zeroed directory of n pointers into slice pointed by dir
+func (s *OffHeapStorage) Dir(n int, dir unsafe.Pointer) {
+	s.a.dir(n, dir)
+}
+
+// FreeDir releases directory, p points to its first element
+func (s *OffHeapStorage) FreeDir(p unsafe.Pointer) {
+	s.a.freeDir(p)
+}
+
+// Release releases all memory, the storage stays usable
+func (s *OffHeapStorage) Release() {
+	s.a.release()
+}
@@ -0,0 +1,28 @@
+//+build debug
+
+package hash
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffHeapLeakCheck(t *testing.T) {
+	leaks := atomic.LoadUint32(&offHeapLeaks)
+	func() {
+		m := NewUintMap(OffHeap)
+		m.Put(1, 1)
+		s := NewUintSet(OffHeap)
+		s.Add(1)
+		s.Free()
+	}()
+	for i := 0; i < 10 && atomic.LoadUint32(&offHeapLeaks) == leaks; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, leaks+1, atomic.LoadUint32(&offHeapLeaks))
+}
@@ -0,0 +1,113 @@
+package hash
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UintMapOffHeap(t *testing.T) {
+	const n = 300000
+	m := NewUintMap(OffHeap)
+	defer m.Free()
+	for i := uint(0); i < n; i++ {
+		m.Put(i, i+1)
+	}
+	runtime.GC() // buckets are invisible to GC and must survive it
+	for i := uint(0); i < n; i++ {
+		assert.Equal(t, i+1, m.Get(i))
+	}
+	for i := uint(0); i < n; i++ {
+		if i%100 != 0 {
+			m.Delete(i)
+		}
+	}
+	m.Compact()
+	assert.EqualValues(t, n/100, m.Len())
+	m.Do(func(k, v uint) {
+		assert.Equal(t, uint(0), k%100)
+		assert.Equal(t, k+1, v)
+	})
+
+	// restored snapshot moves to off-heap storage of the receiver
+	h := NewUintMap()
+	for i := uint(0); i < n/10; i++ {
+		h.Put(i, i*3)
+	}
+	data, err := h.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, m.UnmarshalBinary(data))
+	assert.NotNil(t, m.alloc)
+	runtime.GC()
+	assert.Equal(t, h.Len(), m.Len())
+	h.Do(func(k, v uint) {
+		assert.Equal(t, v, m.Get(k))
+	})
+
+	m.Clear()
+	assert.EqualValues(t, 0, m.Len())
+	m.Put(5, 6)
+	assert.EqualValues(t, 6, m.Get(5))
+}
+
+func TestUsetOffHeap(t *testing.T) {
+	const n = 300000
+	s := NewUintSet(OffHeap, 6)
+	for i := uint(0); i < n; i++ {
+		s.Add(i)
+	}
+	runtime.GC()
+	for i := uint(0); i < n; i += 2 {
+		s.Delete(i)
+	}
+	s.Compact()
+	assert.EqualValues(t, n/2, s.Len())
+	for i := uint(0); i < n; i++ {
+		assert.Equal(t, i%2 == 1, s.Includes(i))
+	}
+	c := s.Clone()
+	s.Free()
+	assert.EqualValues(t, n/2, c.Len())
+	assert.Nil(t, c.alloc)
+
+	assert.Panics(t, func() { NewMap(OffHeap) })
+	assert.Panics(t, func() { NewConcurrentUintMap(OffHeap) })
+}
+
+func Test_OffHeapStorage(t *testing.T) {
+	type bucket struct {
+		keys  [8]int32
+		vals  [8]struct{ x, y float64 }
+		count uint
+	}
+	assert.Panics(t, func() { NewOffHeapStorage(struct{ p *int }{}) })
+	assert.Panics(t, func() { NewOffHeapStorage([4][]byte{}) })
+	assert.Panics(t, func() { NewOffHeapStorage(struct{ s string }{}) })
+
+	s := NewOffHeapStorage(bucket{})
+	var dir []*bucket
+	s.Dir(64, unsafe.Pointer(&dir))
+	assert.Equal(t, 64, len(dir))
+	for i := range dir {
+		assert.Nil(t, dir[i])
+		dir[i] = (*bucket)(s.Bucket())
+		*dir[i] = bucket{count: uint(i)}
+		dir[i].keys[7] = int32(i)
+	}
+	runtime.GC()
+	for i, b := range dir {
+		assert.EqualValues(t, i, b.count)
+		assert.EqualValues(t, i, b.keys[7])
+	}
+	s.FreeBucket(unsafe.Pointer(dir[0]))
+	s.FreeDir(unsafe.Pointer(&dir[0]))
+	s.Release()
+
+	// released storage stays usable
+	b := (*bucket)(s.Bucket())
+	*b = bucket{count: 1}
+	assert.EqualValues(t, 1, b.count)
+	s.Release()
+}
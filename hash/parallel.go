@@ -0,0 +1,209 @@
+package hash
+
+//
+// Parallel bulk operations of UintSet and UintMap.
+// Directory is split into disjoint ranges processed on separate goroutines, every bucket
+// belongs to the range holding its first directory slot. Partial results are merged in range order.
+// Containers must not be modified while an operation runs, concurrent readers are fine.
+// Callbacks run concurrently and must be safe for it.
+//
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallelParts returns number of ranges for optional workers argument
+func parallelParts(dirSize int, workers []int) int {
+	n := runtime.NumCPU()
+	switch len(workers) {
+	case 0:
+	case 1:
+		n = workers[0]
+		if n < 1 {
+			panic("invalid number of workers")
+		}
+	default:
+		panic("usage: Parallel...(..., [workers])")
+	}
+	if n > dirSize {
+		n = dirSize
+	}
+	return n
+}
+
+// parallelRun calls f for parts directory ranges on separate goroutines and waits for them
+func parallelRun(dirSize, parts int, f func(part, lo, hi int)) {
+	var wg sync.WaitGroup
+	wg.Add(parts)
+	for p := 0; p < parts; p++ {
+		go func(p int) {
+			defer wg.Done()
+			f(p, dirSize*p/parts, dirSize*(p+1)/parts)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// UintSet
+
+// doRange calls f for non zero values of buckets starting in directory range [lo, hi)
+func (s *UintSet) doRange(lo, hi int, f func(v uint)) {
+	for di := lo; di < hi; di++ {
+		b := s.dir[di]
+		if di > 0 && b == s.dir[di-1] {
+			continue
+		}
+		for _, v := range b.values {
+			if v != 0 {
+				f(v)
+			}
+		}
+	}
+}
+
+// ParallelDo calls f for every element on optional number of workers (NumCPU by default)
+func (s *UintSet) ParallelDo(f func(v uint), workers ...int) {
+	if s.hasZero {
+		f(0)
+	}
+	parts := parallelParts(len(s.dir), workers)
+	parallelRun(len(s.dir), parts, func(_, lo, hi int) {
+		s.doRange(lo, hi, f)
+	})
+}
+
+// ParallelReduce is Reduce on optional number of workers (NumCPU by default).
+// Every worker reduces its part starting with initial, partial results are combined by merge,
+// so initial must be neutral for merge (like 0 for sum).
+func (s *UintSet) ParallelReduce(initial uint, reducer func(prev, cur uint) uint, merge func(a, b uint) uint, workers ...int) uint {
+	parts := parallelParts(len(s.dir), workers)
+	partial := make([]uint, parts)
+	parallelRun(len(s.dir), parts, func(p, lo, hi int) {
+		cur := initial
+		s.doRange(lo, hi, func(v uint) {
+			cur = reducer(cur, v)
+		})
+		partial[p] = cur
+	})
+	cur := initial
+	if s.hasZero {
+		cur = reducer(cur, 0)
+	}
+	for _, r := range partial {
+		cur = merge(cur, r)
+	}
+	return cur
+}
+
+// ParallelSelect is Select on optional number of workers (NumCPU by default).
+// The result has options of s, off-heap result must be released by Free.
+func (s *UintSet) ParallelSelect(test func(v uint) bool, workers ...int) *UintSet {
+	parts := parallelParts(len(s.dir), workers)
+	partial := make([]*UintSet, parts)
+	parallelRun(len(s.dir), parts, func(p, lo, hi int) {
+		r := s.newResult()
+		add := s.adder(r)
+		s.doRange(lo, hi, func(v uint) {
+			if test(v) {
+				add(v, s.hash(v))
+			}
+		})
+		partial[p] = r
+	})
+	result := s.newResult()
+	if s.hasZero && test(0) {
+		result.Add(0)
+	}
+	for _, r := range partial {
+		result.UnionWith(r)
+		r.Free()
+	}
+	return result
+}
+
+// UintMap
+
+// doRange calls f for entries with non zero keys of buckets starting in directory range [lo, hi)
+func (m *UintMap) doRange(lo, hi int, f func(k, v uint)) {
+	for di := lo; di < hi; di++ {
+		b := m.dir[di]
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		for i := range b.entries {
+			if b.entries[i].key != 0 {
+				f(b.entries[i].key, b.entries[i].value)
+			}
+		}
+	}
+}
+
+// ParallelDo is Do on optional number of workers (NumCPU by default)
+func (m *UintMap) ParallelDo(f func(k, v uint), workers ...int) {
+	if m.zeroEntryAssigned {
+		f(0, m.zeroEntry.value)
+	}
+	parts := parallelParts(len(m.dir), workers)
+	parallelRun(len(m.dir), parts, func(_, lo, hi int) {
+		m.doRange(lo, hi, f)
+	})
+}
+
+// ParallelReduce reduces all entries on optional number of workers (NumCPU by default).
+// Every worker reduces its part starting with initial, partial results are combined by merge,
+// so initial must be neutral for merge (like 0 for sum).
+func (m *UintMap) ParallelReduce(initial uint, reducer func(prev, k, v uint) uint, merge func(a, b uint) uint, workers ...int) uint {
+	parts := parallelParts(len(m.dir), workers)
+	partial := make([]uint, parts)
+	parallelRun(len(m.dir), parts, func(p, lo, hi int) {
+		cur := initial
+		m.doRange(lo, hi, func(k, v uint) {
+			cur = reducer(cur, k, v)
+		})
+		partial[p] = cur
+	})
+	cur := initial
+	if m.zeroEntryAssigned {
+		cur = reducer(cur, 0, m.zeroEntry.value)
+	}
+	for _, r := range partial {
+		cur = merge(cur, r)
+	}
+	return cur
+}
+
+// newResult creates empty map with hasher, probing, growth and off-heap storage options of m
+func (m *UintMap) newResult() *UintMap {
+	r := &UintMap{hasher: m.hasher, incremental: m.incremental, robinHood: m.robinHood}
+	if _, ok := m.alloc.(*offHeapAllocator); ok {
+		r.useOffHeap()
+	}
+	r.init(defaultHashDirBits)
+	return r
+}
+
+// ParallelSelect returns map of entries passing test, on optional number of workers (NumCPU by default).
+// The result has options of m, off-heap result must be released by Free.
+func (m *UintMap) ParallelSelect(test func(k, v uint) bool, workers ...int) *UintMap {
+	parts := parallelParts(len(m.dir), workers)
+	partial := make([]*UintMap, parts)
+	parallelRun(len(m.dir), parts, func(p, lo, hi int) {
+		r := m.newResult()
+		m.doRange(lo, hi, func(k, v uint) {
+			if test(k, v) {
+				r.Put(k, v)
+			}
+		})
+		partial[p] = r
+	})
+	result := m.newResult()
+	if m.zeroEntryAssigned && test(0, m.zeroEntry.value) {
+		result.Put(0, m.zeroEntry.value)
+	}
+	for _, r := range partial {
+		r.Do(result.Put)
+		r.Free()
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package hash
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsetParallel(t *testing.T) {
+	const n = 200000
+	s := NewUintSet()
+	var sum uint
+	for i := uint(0); i < n; i++ {
+		s.Add(i * 3)
+		sum += i * 3
+	}
+	even := func(v uint) bool { return v%2 == 0 }
+	seq := s.Select(even)
+	for _, w := range [][]int{nil, {1}, {3}, {1000000}} {
+		var cnt, psum uint64
+		s.ParallelDo(func(v uint) {
+			atomic.AddUint64(&cnt, 1)
+			atomic.AddUint64(&psum, uint64(v))
+		}, w...)
+		assert.EqualValues(t, n, cnt)
+		assert.EqualValues(t, sum, psum)
+
+		add := func(a, b uint) uint { return a + b }
+		assert.Equal(t, sum, s.ParallelReduce(0, add, add, w...))
+		assert.True(t, seq.Equal(s.ParallelSelect(even, w...)))
+	}
+	assert.Panics(t, func() { s.ParallelDo(func(uint) {}, 0) })
+
+	var empty UintSet
+	assert.EqualValues(t, 0, empty.ParallelSelect(even).Len())
+	assert.EqualValues(t, 7, empty.ParallelReduce(7, nil, nil))
+}
+
+func Test_UintMapParallel(t *testing.T) {
+	const n = 200000
+	m := NewUintMap()
+	var sum uint
+	for i := uint(0); i < n; i++ {
+		m.Put(i, i*2)
+		sum += i * 2
+	}
+	for _, w := range [][]int{nil, {1}, {5}} {
+		var cnt uint64
+		m.ParallelDo(func(k, v uint) {
+			assert.Equal(t, k*2, v)
+			atomic.AddUint64(&cnt, 1)
+		}, w...)
+		assert.EqualValues(t, n, cnt)
+
+		reduced := m.ParallelReduce(0, func(prev, k, v uint) uint { return prev + v }, func(a, b uint) uint { return a + b }, w...)
+		assert.Equal(t, sum, reduced)
+
+		sel := m.ParallelSelect(func(k, v uint) bool { return k%10 == 0 }, w...)
+		assert.EqualValues(t, n/10, sel.Len())
+		sel.Do(func(k, v uint) {
+			assert.Equal(t, uint(0), k%10)
+			assert.Equal(t, k*2, v)
+		})
+	}
+}
+
+func Test_ParallelSelectOptions(t *testing.T) {
+	m := NewUintMap(OffHeap, RobinHood, IncrementalGrowth, WyHasher{Seed: 1})
+	s := NewUintSet(OffHeap, IncrementalGrowth, WyHasher{Seed: 1})
+	for i := uint(0); i < 10000; i++ {
+		m.Put(i, i)
+		s.Add(i)
+	}
+	sel := m.ParallelSelect(func(k, v uint) bool { return k%2 == 0 }, 3)
+	assert.EqualValues(t, 5000, sel.Len())
+	_, offHeap := sel.alloc.(*offHeapAllocator)
+	assert.True(t, offHeap && sel.robinHood && sel.incremental)
+	assert.True(t, sameHasher(m.hasher, sel.hasher))
+	sel.Free()
+
+	ss := s.ParallelSelect(func(v uint) bool { return v%2 == 0 }, 3)
+	assert.EqualValues(t, 5000, ss.Len())
+	_, offHeap = ss.alloc.(*offHeapAllocator)
+	assert.True(t, offHeap && ss.incremental)
+	ss.Free()
+	m.Free()
+	s.Free()
+}
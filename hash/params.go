@@ -2,3 +2,7 @@ package hash
 
 const entriesPerHashBucket = 227
 const defaultHashDirBits = 4
+
+// buddy buckets are merged when they hold no more entries than this together,
+// the gap to entriesPerHashBucket keeps delete/insert sequences from splitting and merging the same bucket
+const mergeHashBucketThreshold = entriesPerHashBucket / 3
@@ -0,0 +1,89 @@
+package hash
+
+//
+// Robin Hood probing in UintMap buckets.
+//
+// With linear probing a miss scans up to the next empty slot, which in a bucket filled close
+// to entriesPerHashBucket entries is a long way. Robin Hood probing keeps entries of a probe
+// cluster ordered by home slot: an entry is inserted before the first entry displaced less than
+// itself, shifting the rest of the cluster one slot forward. A lookup of key displaced by d
+// stops at the first entry displaced less than d, so misses end about as early as hits.
+// Displacements are not stored, they are computed from hash codes of the keys when probing,
+// so buckets keep the layout and size of linear probing ones.
+//
+// Deletion shifts the following entries displaced from their home slots one slot back
+// (backward shift), so no tombstones are needed. Entries move only forward on insertion and
+// backward on deletion, as with linear probing, and iterators handle both the same way.
+//
+// Robin Hood layout is also a valid linear probing layout, so snapshots of both kinds of maps
+// are interchangeable. Snapshot read into Robin Hood map is reordered bucket by bucket.
+//
+
+// prefix: robin
+
+type robinHoodOption struct{}
+
+// RobinHood passed to NewUintMap selects Robin Hood probing in buckets
+var RobinHood robinHoodOption
+
+// robinDist returns displacement of non empty slot i of bucket b from its home slot
+func (m *UintMap) robinDist(b *uumBucket, i uint) uint {
+	return (i + entriesPerHashBucket - m.hash(b.entries[i].key)%entriesPerHashBucket) % entriesPerHashBucket
+}
+
+// robinLookup is lookup with Robin Hood probing. If the key is absent, the slot is where
+// the key would be inserted.
+func (m *UintMap) robinLookup(key, h uint) (b *uumBucket, elementIndex uint, found bool) {
+	b = m.dir[h>>(bitsPerHashCode-m.dirBits)]
+	elementIndex = h % entriesPerHashBucket
+	for d := uint(0); d < entriesPerHashBucket; d++ {
+		k := b.entries[elementIndex].key
+		if k == key {
+			return b, elementIndex, true
+		}
+		if k == 0 || m.robinDist(b, elementIndex) < d {
+			return b, elementIndex, false
+		}
+		elementIndex = (elementIndex + 1) % entriesPerHashBucket
+	}
+	return b, elementIndex, false
+}
+
+// robinOpen frees slot elemIndex of bucket b, which is not full, by shifting the cluster
+// starting there one slot forward
+func (m *UintMap) robinOpen(b *uumBucket, elemIndex uint) {
+	i := elemIndex
+	for b.entries[i].key != 0 {
+		i = (i + 1) % entriesPerHashBucket
+	}
+	for i != elemIndex {
+		prev := (i + entriesPerHashBucket - 1) % entriesPerHashBucket
+		b.entries[i] = b.entries[prev]
+		i = prev
+	}
+	b.entries[elemIndex].key = 0
+}
+
+// robinRemoveAt empties slot elemIndex of bucket b, moving back displaced entries after it
+func (m *UintMap) robinRemoveAt(b *uumBucket, elemIndex uint) {
+	for i := elemIndex; ; {
+		next := (i + 1) % entriesPerHashBucket
+		if next == elemIndex || b.entries[next].key == 0 || m.robinDist(b, next) == 0 {
+			b.entries[i].key = 0
+			return
+		}
+		b.entries[i] = b.entries[next]
+		i = next
+	}
+}
+
+// robinRebuild reorders entries of bucket b laid out by linear probing
+func (m *UintMap) robinRebuild(b *uumBucket) {
+	entries := b.entries
+	b.entries = [entriesPerHashBucket]uumEntry{}
+	for _, e := range entries {
+		if e.key != 0 {
+			b.entries[m.place(b, m.hash(e.key))] = e
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package hash
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkRobinHood verifies Robin Hood order of every bucket
+func checkRobinHood(t *testing.T, m *UintMap) {
+	for di, b := range m.dir {
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		count := uint(0)
+		for i := uint(0); i < entriesPerHashBucket; i++ {
+			if b.entries[i].key == 0 {
+				continue
+			}
+			count++
+			d := m.robinDist(b, i)
+			prev := (i + entriesPerHashBucket - 1) % entriesPerHashBucket
+			if d > 0 && (b.entries[prev].key == 0 || d > m.robinDist(b, prev)+1) {
+				t.Fatalf("slot %d: displacement %d after %d", i, d, m.robinDist(b, prev))
+			}
+		}
+		assert.Equal(t, b.count, count)
+	}
+}
+
+func Test_RobinHoodUintMap(t *testing.T) {
+	const n = 200000
+	m := NewUintMap(RobinHood)
+	model := make(map[uint]uint)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 4*n; i++ {
+		k := uint(r.Intn(n))
+		switch r.Intn(4) {
+		case 0:
+			assert.Equal(t, model[k] != 0, m.Delete(k))
+			delete(model, k)
+		case 1:
+			assert.Equal(t, model[k], m.Get(k))
+		default:
+			m.Inc(k, 1)
+			model[k]++
+		}
+		if i%(n/2) == 0 {
+			checkRobinHood(t, m)
+		}
+	}
+	checkRobinHood(t, m)
+	assert.EqualValues(t, len(model), m.Len())
+	for k, v := range model {
+		assert.Equal(t, v, m.Get(k))
+	}
+	for k := uint(n); k < 2*n; k++ {
+		assert.False(t, m.Exists(k))
+	}
+
+	for k := range model {
+		if k%3 != 0 {
+			m.Delete(k)
+			delete(model, k)
+		}
+	}
+	m.Compact()
+	checkRobinHood(t, m)
+	for k, v := range model {
+		assert.Equal(t, v, m.Get(k))
+	}
+
+	assert.Panics(t, func() { NewUintSet(RobinHood) })
+	assert.Panics(t, func() { NewMap(RobinHood) })
+	assert.Panics(t, func() { NewConcurrentUintMap(RobinHood) })
+}
+
+func Test_RobinHoodFullBucket(t *testing.T) {
+	// the first bucket covers the whole directory, filled up to the last slot and emptied again
+	m := NewUintMap(RobinHood)
+	keys := make([]uint, 0, entriesPerHashBucket)
+	for k := uint(1); len(keys) < entriesPerHashBucket; k++ {
+		keys = append(keys, k)
+		m.Put(k, k)
+	}
+	assert.Equal(t, 1, m.BucketCount())
+	checkRobinHood(t, m)
+	for i, k := range keys {
+		assert.True(t, m.Delete(k))
+		assert.False(t, m.Exists(k))
+		if i%16 == 0 {
+			checkRobinHood(t, m)
+		}
+	}
+	assert.EqualValues(t, 0, m.Len())
+}
+
+func Test_RobinHoodIteratorDelete(t *testing.T) {
+	m := NewUintMap(RobinHood)
+	for k := uint(0); k < 100000; k++ {
+		m.Put(k, k)
+	}
+	seen := make(map[uint]bool)
+	for it := m.Iterator(); it.Next(); {
+		k := it.CurKey()
+		assert.False(t, seen[k])
+		seen[k] = true
+		if k%2 == 0 {
+			it.DeleteCurrent()
+		}
+	}
+	assert.Equal(t, 100000, len(seen))
+	assert.EqualValues(t, 50000, m.Len())
+	checkRobinHood(t, m)
+}
+
+func Test_RobinHoodSnapshot(t *testing.T) {
+	linear := NewUintMap()
+	for k := uint(0); k < 100000; k++ {
+		linear.Put(k*7, k)
+	}
+	data, err := linear.MarshalBinary()
+	assert.NoError(t, err)
+
+	m := NewUintMap(RobinHood, OffHeap, IncrementalGrowth)
+	defer m.Free()
+	assert.NoError(t, m.UnmarshalBinary(data))
+	assert.True(t, m.robinHood)
+	checkRobinHood(t, m)
+	for k := uint(0); k < 100000; k++ {
+		assert.Equal(t, k, m.Get(k*7))
+	}
+	for k := uint(100000); k < 200000; k++ {
+		m.Put(k*7, k)
+	}
+	checkRobinHood(t, m)
+
+	// Robin Hood layout is read by linear probing map as is
+	data, err = m.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, linear.UnmarshalBinary(data))
+	for k := uint(0); k < 200000; k++ {
+		assert.Equal(t, k, linear.Get(k*7))
+	}
+}
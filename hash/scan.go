@@ -0,0 +1,108 @@
+package hash
+
+//
+// Resumable cursor based scanning of UintMap and UintSet.
+//
+// Directory of extendible hash is indexed by the top bits of hash code, so every bucket holds
+// a contiguous range of hash codes, and splits, directory doubling and merges only cut or join
+// these ranges. Scan walks the containers in hash code order and the cursor is simply the lowest
+// hash code not returned yet, so no restructuring between calls can move an element behind it.
+//
+
+import "sort"
+
+type scanEntry struct {
+	hash uint
+	key  uint
+}
+
+// scanBatch sorts entries of a bucket by hash code and appends their keys to keys until limit
+// is reached. Entries with equal hash codes are never separated, so the cursor stays exact.
+// Returns the next cursor, or done if the bucket was exhausted.
+func scanBatch(keys []uint, c []scanEntry, limit int) (_ []uint, next uint, done bool) {
+	sort.Slice(c, func(i, j int) bool { return c[i].hash < c[j].hash })
+	for i := range c {
+		keys = append(keys, c[i].key)
+		if len(keys) >= limit && i+1 < len(c) && c[i+1].hash != c[i].hash {
+			return keys, c[i].hash + 1, false
+		}
+	}
+	return keys, 0, true
+}
+
+// scanBucketEnd returns the first hash code after the range of bucket with given bits
+// that contains hash code h, or 0 if the range runs up to the end of hash space.
+func scanBucketEnd(h, bits uint) uint {
+	if bits == 0 {
+		return 0
+	}
+	return ((h >> (bitsPerHashCode - bits)) + 1) << (bitsPerHashCode - bits)
+}
+
+// Scan returns up to limit keys (a few more if hash codes collide) starting from cursor
+// and the cursor to resume from. Scanning starts with cursor 0 and is over when returned cursor is 0.
+// Every key present during the whole scan is returned at least once whatever modifications
+// are made between calls, keys added or deleted meanwhile may be returned or not.
+func (m *UintMap) Scan(cursor uint, limit int) (keys []uint, next uint) {
+	if limit < 1 {
+		panic("invalid scan limit")
+	}
+	keys = make([]uint, 0, limit)
+	if cursor == 0 && m.zeroEntryAssigned {
+		keys = append(keys, 0)
+	}
+	var c []scanEntry
+	for {
+		b := m.dir[cursor>>(bitsPerHashCode-m.dirBits)]
+		c = c[:0]
+		for i := range b.entries {
+			if k := b.entries[i].key; k != 0 {
+				if h := m.hash(k); h >= cursor {
+					c = append(c, scanEntry{h, k})
+				}
+			}
+		}
+		var done bool
+		if keys, next, done = scanBatch(keys, c, limit); !done {
+			return
+		}
+		next = scanBucketEnd(cursor, b.bits)
+		if next == 0 || len(keys) >= limit {
+			return
+		}
+		cursor = next
+	}
+}
+
+// Scan returns up to limit values starting from cursor and the cursor to resume from.
+// See UintMap.Scan.
+func (s *UintSet) Scan(cursor uint, limit int) (values []uint, next uint) {
+	if limit < 1 {
+		panic("invalid scan limit")
+	}
+	values = make([]uint, 0, limit)
+	if cursor == 0 && s.hasZero {
+		values = append(values, 0)
+	}
+	var c []scanEntry
+	for {
+		b := s.dir[cursor>>(bitsPerHashCode-s.dirBits)]
+		c = c[:0]
+		for _, v := range b.values {
+			if v != 0 {
+				if h := s.hash(v); h >= cursor {
+					c = append(c, scanEntry{h, v})
+				}
+			}
+		}
+		var done bool
+		if values, next, done = scanBatch(values, c, limit); !done {
+			return
+		}
+		next = scanBucketEnd(cursor, b.bits)
+		if next == 0 || len(values) >= limit {
+			return
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,110 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UintMapScan(t *testing.T) {
+	const n = 50000
+	m := NewUintMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(i, i)
+	}
+	for _, limit := range []int{1, 10, 1000, 2 * n} {
+		seen := make(map[uint]bool)
+		calls := 0
+		for cursor := uint(0); ; {
+			var keys []uint
+			keys, cursor = m.Scan(cursor, limit)
+			calls++
+			for _, k := range keys {
+				assert.False(t, seen[k])
+				seen[k] = true
+			}
+			if cursor == 0 {
+				break
+			}
+			assert.True(t, len(keys) >= limit)
+		}
+		assert.Equal(t, n, len(seen))
+		assert.True(t, calls <= n/limit+2)
+	}
+	keys, next := NewUintMap().Scan(0, 10)
+	assert.Equal(t, 0, len(keys))
+	assert.EqualValues(t, 0, next)
+}
+
+func Test_UintMapScanRestructured(t *testing.T) {
+	// stable keys are present during the whole scan, while other keys come and go
+	// forcing splits, directory doubling and merges between the calls
+	const n = 20000
+	m := NewUintMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(i*2, 1)
+	}
+	seen := make(map[uint]bool)
+	next := uint(n * 2)
+	step := 0
+	for cursor := uint(0); ; step++ {
+		var keys []uint
+		keys, cursor = m.Scan(cursor, 100)
+		for _, k := range keys {
+			seen[k] = true
+		}
+		if cursor == 0 {
+			break
+		}
+		switch step % 4 {
+		case 0, 1:
+			for i := 0; i < 2000; i++ {
+				m.Put(next|1, 1)
+				next += 2
+			}
+		case 2:
+			for k := next - 8000; k < next; k += 2 {
+				m.Delete(k | 1)
+			}
+		case 3:
+			m.Compact()
+		}
+	}
+	for i := uint(0); i < n; i++ {
+		assert.True(t, seen[i*2])
+	}
+}
+
+func TestUsetScan(t *testing.T) {
+	const n = 20000
+	s := NewUintSet()
+	for i := uint(0); i < n; i++ {
+		s.Add(i * 2)
+	}
+	seen := make(map[uint]int)
+	next := uint(n * 2)
+	for cursor, step := uint(0), 0; ; step++ {
+		var values []uint
+		values, cursor = s.Scan(cursor, 64)
+		for _, v := range values {
+			seen[v]++
+		}
+		if cursor == 0 {
+			break
+		}
+		if step%2 == 0 {
+			for i := 0; i < 500; i++ {
+				s.Add(next | 1)
+				next += 2
+			}
+		} else {
+			for k := next - 1000; k < next; k += 2 {
+				s.Delete(k | 1)
+			}
+			s.Compact()
+		}
+	}
+	for i := uint(0); i < n; i++ {
+		assert.Equal(t, 1, seen[i*2])
+	}
+}
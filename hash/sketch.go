@@ -0,0 +1,63 @@
+package hash
+
+//
+// Binary encoding of probabilistic filters and sketches.
+// All numbers are little-endian uint64 unless noted otherwise:
+//
+//	magic       [4]byte, identifies the structure
+//	version     uint32
+//	params      fixed number of words, meaning depends on the structure
+//	data        words up to the checksum
+//	checksum    uint32 CRC-32C of all preceding bytes
+//
+// Decoding errors are the snapshot ones: the format is the snapshot format without buckets.
+//
+
+// prefix: sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const sketchVersion = 1
+
+var SketchMismatchError = errors.New("filters or sketches have different parameters")
+
+// sketchEncode encodes params and data words
+func sketchEncode(magic [4]byte, params []uint64, data []uint64) []byte {
+	buf := make([]byte, 8, 8+8*(len(params)+len(data))+4)
+	copy(buf, magic[:])
+	binary.LittleEndian.PutUint32(buf[4:], sketchVersion)
+	var w [8]byte
+	for _, v := range params {
+		binary.LittleEndian.PutUint64(w[:], v)
+		buf = append(buf, w[:]...)
+	}
+	for _, v := range data {
+		binary.LittleEndian.PutUint64(w[:], v)
+		buf = append(buf, w[:]...)
+	}
+	binary.LittleEndian.PutUint32(w[:], crc32.Checksum(buf, snapshotCrcTable))
+	return append(buf, w[:4]...)
+}
+
+// sketchDecode decodes nparams params and following data words
+func sketchDecode(buf []byte, magic [4]byte, nparams int) (params []uint64, data []uint64, err error) {
+	if len(buf) < 8+8*nparams+4 || (len(buf)-12)%8 != 0 || string(buf[:4]) != string(magic[:]) {
+		return nil, nil, SnapshotFormatError
+	}
+	if binary.LittleEndian.Uint32(buf[4:]) != sketchVersion {
+		return nil, nil, SnapshotVersionError
+	}
+	end := len(buf) - 4
+	if binary.LittleEndian.Uint32(buf[end:]) != crc32.Checksum(buf[:end], snapshotCrcTable) {
+		return nil, nil, SnapshotChecksumError
+	}
+	words := make([]uint64, (end-8)/8)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(buf[8+8*i:])
+	}
+	return words[:nparams], words[nparams:], nil
+}
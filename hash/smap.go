@@ -0,0 +1,101 @@
+package hash
+
+//
+// StringMap
+// Dense map of string->uint. Thin wrapper around BytesMap, string keys are never copied on lookup.
+//
+
+// prefix: sm
+
+import "unsafe"
+
+type StringMapIterator struct {
+	it BytesMapIterator
+}
+
+func (it *StringMapIterator) Reset() {
+	it.it.Reset()
+}
+func (it *StringMapIterator) Next() bool {
+	return it.it.Next()
+}
+
+// Return current map key. The string shares memory with the map's arena, which is never overwritten.
+func (it *StringMapIterator) CurKey() string {
+	return bytesString(it.it.CurKey())
+}
+func (it *StringMapIterator) Cur() uint {
+	return it.it.Cur()
+}
+
+type StringMap struct {
+	m BytesMap
+}
+
+// NewStringMap creates map. Optional arguments are initial directory bits and Hasher seeding key hash codes.
+func NewStringMap(args ...interface{}) *StringMap {
+	const usage = "usage: NewStringMap([initDirBits], [hasher])"
+	o := parseContainerOptions(args, usage)
+	o.plainOnly(usage)
+	return &StringMap{m: *NewBytesMap(args...)}
+}
+
+// stringBytes returns bytes of s without copying. Result must not be modified.
+func stringBytes(s string) []byte {
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		int
+	}{s, len(s)}))
+}
+
+// bytesString returns string sharing memory with b
+func bytesString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+func (m *StringMap) Clear() {
+	m.m.Clear()
+}
+func (m *StringMap) Iterator() StringMapIterator {
+	return StringMapIterator{it: m.m.Iterator()}
+}
+func (m *StringMap) Get(key string) uint {
+	return m.m.Get(stringBytes(key))
+}
+func (m *StringMap) Put(key string, value uint) {
+	m.m.Put(stringBytes(key), value)
+}
+func (m *StringMap) Inc(key string, delta uint) {
+	m.m.Inc(stringBytes(key), delta)
+}
+func (m *StringMap) Dec(key string, delta uint) {
+	m.m.Dec(stringBytes(key), delta)
+}
+func (m *StringMap) Exists(key string) bool {
+	return m.m.Exists(stringBytes(key))
+}
+func (m *StringMap) IncludesKey(key string) bool {
+	return m.m.IncludesKey(stringBytes(key))
+}
+func (m *StringMap) Delete(key string) bool {
+	return m.m.Delete(stringBytes(key))
+}
+func (m *StringMap) Len() uint {
+	return m.m.Len()
+}
+func (m *StringMap) DirSize() int {
+	return m.m.DirSize()
+}
+func (m *StringMap) BucketCount() int {
+	return m.m.BucketCount()
+}
+func (m *StringMap) ArenaSize() int {
+	return m.m.ArenaSize()
+}
+
+// Do calls f for every entry. Key strings share memory with the map's arena, which is never overwritten.
+func (m *StringMap) Do(f func(string, uint)) {
+	m.m.Do(func(k []byte, v uint) {
+		f(bytesString(k), v)
+	})
+}
@@ -0,0 +1,56 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StringMap(t *testing.T) {
+	const n = 100000
+	m := NewStringMap()
+	for i := 0; i < n; i++ {
+		m.Put(strconv.Itoa(i), uint(i))
+	}
+	assert.EqualValues(t, n, m.Len())
+	for i := 0; i < n; i++ {
+		assert.EqualValues(t, i, m.Get(strconv.Itoa(i)))
+	}
+	for i := 0; i < n; i += 3 {
+		assert.True(t, m.Delete(strconv.Itoa(i)))
+	}
+	seen := 0
+	for it := m.Iterator(); it.Next(); {
+		v, err := strconv.Atoi(it.CurKey())
+		assert.NoError(t, err)
+		assert.EqualValues(t, v, it.Cur())
+		assert.NotZero(t, v%3)
+		seen++
+	}
+	assert.EqualValues(t, m.Len(), seen)
+
+	var kept []string
+	m.Do(func(k string, v uint) {
+		if len(kept) < 100 {
+			kept = append(kept, k)
+		}
+	})
+	// keys handed out earlier stay intact after the map moves on
+	m.Clear()
+	for i := 0; i < 1000; i++ {
+		m.Put("overwrite-"+strconv.Itoa(i), 0)
+	}
+	for _, k := range kept {
+		v, err := strconv.Atoi(k)
+		assert.NoError(t, err)
+		assert.NotZero(t, v%3)
+	}
+
+	key := "1"
+	allocs := testing.AllocsPerRun(1000, func() {
+		m.Inc(key, 1)
+		m.Get(key)
+	})
+	assert.EqualValues(t, 0, allocs)
+}
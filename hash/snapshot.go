@@ -0,0 +1,472 @@
+package hash
+
+//
+// Binary snapshots of UintMap and UintSet.
+//
+// Snapshot keeps directory and bucket layout, so restoring does not rehash or split anything.
+// All numbers are little-endian uint64 unless noted otherwise:
+//
+//	magic       [4]byte  "GUMS" for UintMap, "GUSS" for UintSet
+//	version     uint32
+//	dirBits
+//	hasZero     0 or 1
+//	zeroValue   (value of key 0 for UintMap, always 0 for UintSet)
+//	count
+//	buckets     number of distinct buckets
+//	buckets times, in directory order:
+//		bits, count, entriesPerHashBucket entries (key, value pairs for UintMap, values for UintSet)
+//	checksum    uint32 CRC-32C of all preceding bytes
+//
+// Directory is not stored: every bucket covers 2^(dirBits-bits) consecutive directory slots.
+// Directory of more than 2^snapshotMaxSmallDirBits slots may have at most snapshotMaxSlotsPerBucket
+// slots per bucket, so that its allocation is bounded by the length of the snapshot.
+// Hasher is not stored either, snapshot must be restored into container with the same hasher.
+// Keys are not rehashed on restore, the checksum guards against corruption. Only the first key
+// of every bucket is checked to belong there, which detects a container with another hasher.
+//
+
+// prefix: snap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+const snapshotVersion = 1
+
+const (
+	snapshotMaxSmallDirBits   = 24
+	snapshotMaxSlotsPerBucket = 1 << 16
+)
+
+var (
+	SnapshotFormatError   = errors.New("invalid snapshot format")
+	SnapshotVersionError  = errors.New("unsupported snapshot version")
+	SnapshotChecksumError = errors.New("snapshot checksum mismatch")
+)
+
+var (
+	uintMapSnapshotMagic = [4]byte{'G', 'U', 'M', 'S'}
+	uintSetSnapshotMagic = [4]byte{'G', 'U', 'S', 'S'}
+	snapshotCrcTable     = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type snapshotHeader struct {
+	dirBits   uint
+	hasZero   bool
+	zeroValue uint
+	count     uint
+	buckets   uint
+}
+
+// snapshotWriter writes little-endian words while maintaining checksum
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc uint32
+	n   int64
+	err error
+	buf []byte
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	return &snapshotWriter{w: bufio.NewWriterSize(w, 64*1024)}
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc = crc32.Update(sw.crc, snapshotCrcTable, p)
+	n, err := sw.w.Write(p)
+	sw.n += int64(n)
+	sw.err = err
+}
+
+// flushWords writes buffered words and resets the buffer
+func (sw *snapshotWriter) flushWords() {
+	sw.write(sw.buf)
+	sw.buf = sw.buf[:0]
+}
+
+func (sw *snapshotWriter) word(v uint) {
+	sw.buf = append(sw.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(sw.buf[len(sw.buf)-8:], uint64(v))
+}
+
+func (sw *snapshotWriter) header(magic [4]byte, h *snapshotHeader) {
+	var prefix [8]byte
+	copy(prefix[:4], magic[:])
+	binary.LittleEndian.PutUint32(prefix[4:], snapshotVersion)
+	sw.write(prefix[:])
+	sw.word(h.dirBits)
+	if h.hasZero {
+		sw.word(1)
+	} else {
+		sw.word(0)
+	}
+	sw.word(h.zeroValue)
+	sw.word(h.count)
+	sw.word(h.buckets)
+	sw.flushWords()
+}
+
+func (sw *snapshotWriter) finish() (int64, error) {
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], sw.crc)
+	sw.write(sum[:])
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	return sw.n, sw.err
+}
+
+// snapshotReader reads little-endian words while maintaining checksum
+type snapshotReader struct {
+	r   io.Reader
+	crc uint32
+	n   int64
+	err error
+	buf []byte
+}
+
+// newSnapshotReader does not buffer r, so nothing past the end of snapshot is consumed
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	return &snapshotReader{r: r}
+}
+
+func (sr *snapshotReader) read(p []byte) {
+	if sr.err != nil {
+		return
+	}
+	n, err := io.ReadFull(sr.r, p)
+	sr.n += int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		sr.err = err
+		return
+	}
+	sr.crc = crc32.Update(sr.crc, snapshotCrcTable, p)
+}
+
+// words reads n words into internal buffer, subsequent word calls take them in order
+func (sr *snapshotReader) words(n int) {
+	if cap(sr.buf) < n*8 {
+		sr.buf = make([]byte, n*8)
+	}
+	sr.buf = sr.buf[:n*8]
+	sr.read(sr.buf)
+}
+
+func (sr *snapshotReader) word() uint {
+	if sr.err != nil {
+		return 0
+	}
+	v := uint(binary.LittleEndian.Uint64(sr.buf))
+	sr.buf = sr.buf[8:]
+	return v
+}
+
+func (sr *snapshotReader) header(magic [4]byte) (h snapshotHeader) {
+	var prefix [8]byte
+	sr.read(prefix[:])
+	if sr.err != nil {
+		return
+	}
+	if !bytes.Equal(prefix[:4], magic[:]) {
+		sr.err = SnapshotFormatError
+		return
+	}
+	if binary.LittleEndian.Uint32(prefix[4:]) != snapshotVersion {
+		sr.err = SnapshotVersionError
+		return
+	}
+	sr.words(5)
+	h.dirBits = sr.word()
+	zf := sr.word()
+	h.hasZero = zf == 1
+	h.zeroValue = sr.word()
+	h.count = sr.word()
+	h.buckets = sr.word()
+	if sr.err == nil && (zf > 1 || h.dirBits > bitsPerHashCode-3 || h.buckets == 0 || h.buckets > 1<<h.dirBits ||
+		(h.dirBits > snapshotMaxSmallDirBits && 1<<h.dirBits/snapshotMaxSlotsPerBucket > h.buckets)) {
+		sr.err = SnapshotFormatError
+	}
+	return
+}
+
+func (sr *snapshotReader) finish() (int64, error) {
+	crc := sr.crc
+	var sum [4]byte
+	sr.read(sum[:])
+	if sr.err == nil && binary.LittleEndian.Uint32(sum[:]) != crc {
+		sr.err = SnapshotChecksumError
+	}
+	return sr.n, sr.err
+}
+
+// bucketSpan validates bucket depth against directory position and returns number of slots the bucket covers
+func bucketSpan(dirBits, bits, pos uint) (uint, bool) {
+	if bits > dirBits {
+		return 0, false
+	}
+	span := uint(1) << (dirBits - bits)
+	if pos%span != 0 || pos+span > 1<<dirBits {
+		return 0, false
+	}
+	return span, true
+}
+
+// ownsHash checks that hash code h belongs to the bucket covering directory slots [pos, pos+span)
+func ownsHash(h, dirBits, pos, span uint) bool {
+	di := h >> (bitsPerHashCode - dirBits)
+	return di >= pos && di < pos+span
+}
+
+// UintMap snapshots
+
+// WriteTo writes binary snapshot of the map to w
+func (m *UintMap) WriteTo(w io.Writer) (int64, error) {
+	sw := newSnapshotWriter(w)
+	sw.header(uintMapSnapshotMagic, &snapshotHeader{
+		dirBits:   m.dirBits,
+		hasZero:   m.zeroEntryAssigned,
+		zeroValue: m.zeroEntry.value,
+		count:     m.count,
+		buckets:   uint(m.BucketCount()),
+	})
+	for di := 0; di < len(m.dir); di++ {
+		b := m.dir[di]
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		sw.word(b.bits)
+		sw.word(b.count)
+		for i := range b.entries {
+			sw.word(b.entries[i].key)
+			sw.word(b.entries[i].value)
+		}
+		sw.flushWords()
+	}
+	return sw.finish()
+}
+
+// ReadFrom replaces content of the map with snapshot read from r.
+// On error the map is left unchanged. Split and merge counters of Stats start from zero.
+func (m *UintMap) ReadFrom(r io.Reader) (int64, error) {
+	sr := newSnapshotReader(r)
+	h := sr.header(uintMapSnapshotMagic)
+	if sr.err != nil {
+		return sr.n, sr.err
+	}
+	t := UintMap{hasher: m.hasher, hashShift: m.hashShift, robinHood: m.robinHood}
+	t.dirBits = h.dirBits
+	buckets := make([]*uumBucket, 0, 64)
+	t.zeroEntryAssigned = h.hasZero
+	if h.hasZero {
+		t.zeroEntry.value = h.zeroValue
+		t.count++
+	}
+	pos := uint(0)
+	for bi := uint(0); bi < h.buckets && sr.err == nil; bi++ {
+		sr.words(2 + 2*entriesPerHashBucket)
+		b := &uumBucket{bits: sr.word()}
+		count := sr.word()
+		for i := range b.entries {
+			b.entries[i].key = sr.word()
+			b.entries[i].value = sr.word()
+		}
+		if sr.err != nil {
+			break
+		}
+		span, ok := bucketSpan(h.dirBits, b.bits, pos)
+		if !ok {
+			sr.err = SnapshotFormatError
+			break
+		}
+		for i := range b.entries {
+			if k := b.entries[i].key; k != 0 {
+				if b.count == 0 && !ownsHash(t.hash(k), h.dirBits, pos, span) {
+					sr.err = SnapshotFormatError
+					break
+				}
+				b.count++
+			}
+		}
+		if b.count != count {
+			sr.err = SnapshotFormatError
+		}
+		buckets = append(buckets, b)
+		pos += span
+		t.count += b.count
+	}
+	if sr.err == nil && (pos != 1<<h.dirBits || t.count != h.count) {
+		sr.err = SnapshotFormatError
+	}
+	n, err := sr.finish()
+	if err == nil {
+		// directory is allocated only after the snapshot has been verified
+		t.dir = make([]*uumBucket, 0, 1<<h.dirBits)
+		for _, b := range buckets {
+			if t.robinHood {
+				t.robinRebuild(b)
+			}
+			for i := 1 << (h.dirBits - b.bits); i > 0; i-- {
+				t.dir = append(t.dir, b)
+			}
+		}
+		t.mods = m.mods + 1
+		m.assign(&t)
+	}
+	return n, err
+}
+
+func (m *UintMap) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+func (m *UintMap) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	t := UintMap{hasher: m.hasher, hashShift: m.hashShift, robinHood: m.robinHood}
+	if _, err := t.ReadFrom(r); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return SnapshotFormatError
+	}
+	t.mods = m.mods + 1
+	m.assign(&t)
+	return nil
+}
+
+// UintSet snapshots
+
+// WriteTo writes binary snapshot of the set to w
+func (s *UintSet) WriteTo(w io.Writer) (int64, error) {
+	if race {
+		s.readaccess()
+	}
+	if s.dir == nil {
+		s.init(defaultHashDirBits)
+	}
+	sw := newSnapshotWriter(w)
+	buckets := 1
+	for i := 1; i < len(s.dir); i++ {
+		if s.dir[i] != s.dir[i-1] {
+			buckets++
+		}
+	}
+	sw.header(uintSetSnapshotMagic, &snapshotHeader{
+		dirBits: s.dirBits,
+		hasZero: s.hasZero,
+		count:   s.count,
+		buckets: uint(buckets),
+	})
+	for di := 0; di < len(s.dir); di++ {
+		b := s.dir[di]
+		if di > 0 && b == s.dir[di-1] {
+			continue
+		}
+		sw.word(b.bits)
+		sw.word(b.count)
+		for _, v := range b.values {
+			sw.word(v)
+		}
+		sw.flushWords()
+	}
+	return sw.finish()
+}
+
+// ReadFrom replaces content of the set with snapshot read from r.
+// On error the set is left unchanged. Split and merge counters of Stats start from zero.
+func (s *UintSet) ReadFrom(r io.Reader) (int64, error) {
+	sr := newSnapshotReader(r)
+	h := sr.header(uintSetSnapshotMagic)
+	if sr.err != nil {
+		return sr.n, sr.err
+	}
+	if h.zeroValue != 0 {
+		return sr.n, SnapshotFormatError
+	}
+	t := UintSet{hasher: s.hasher, shift: s.shift}
+	t.dirBits = h.dirBits
+	buckets := make([]*usBucket, 0, 64)
+	t.hasZero = h.hasZero
+	if h.hasZero {
+		t.count++
+	}
+	pos := uint(0)
+	for bi := uint(0); bi < h.buckets && sr.err == nil; bi++ {
+		sr.words(2 + entriesPerHashBucket)
+		b := t.newBucket(sr.word())
+		count := sr.word()
+		for i := range b.values {
+			b.values[i] = sr.word()
+		}
+		if sr.err != nil {
+			break
+		}
+		span, ok := bucketSpan(h.dirBits, b.bits, pos)
+		if !ok {
+			sr.err = SnapshotFormatError
+			break
+		}
+		for _, v := range b.values {
+			if v != 0 {
+				if b.count == 0 && !ownsHash(t.hash(v), h.dirBits, pos, span) {
+					sr.err = SnapshotFormatError
+					break
+				}
+				b.count++
+			}
+		}
+		if b.count != count {
+			sr.err = SnapshotFormatError
+		}
+		buckets = append(buckets, b)
+		pos += span
+		t.count += b.count
+	}
+	if sr.err == nil && (pos != 1<<h.dirBits || t.count != h.count) {
+		sr.err = SnapshotFormatError
+	}
+	n, err := sr.finish()
+	if err == nil {
+		t.dir = make([]*usBucket, 0, 1<<h.dirBits)
+		for _, b := range buckets {
+			for i := 1 << (h.dirBits - b.bits); i > 0; i-- {
+				t.dir = append(t.dir, b)
+			}
+		}
+		t.mods = s.mods + 1
+		s.assign(&t)
+	}
+	return n, err
+}
+
+func (s *UintSet) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+func (s *UintSet) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	t := UintSet{hasher: s.hasher, shift: s.shift}
+	if _, err := t.ReadFrom(r); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return SnapshotFormatError
+	}
+	t.mods = s.mods + 1
+	s.assign(&t)
+	return nil
+}
@@ -0,0 +1,160 @@
+package hash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/pi/goal/th"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UintMapSnapshot(t *testing.T) {
+	const n = 200000
+	m := NewUintMap()
+	kg := th.NewSeqGen(th.SgRand)
+	for i := 0; i < n; i++ {
+		m.Inc(kg.Next(), 1)
+	}
+	m.Put(0, 77)
+
+	data, err := m.MarshalBinary()
+	assert.NoError(t, err)
+
+	r := NewUintMap()
+	r.Put(1, 1)
+	assert.NoError(t, r.UnmarshalBinary(data))
+	assert.Equal(t, m.Len(), r.Len())
+	assert.Equal(t, m.DirSize(), r.DirSize())
+	assert.Equal(t, m.BucketCount(), r.BucketCount())
+	assert.EqualValues(t, 77, r.Get(0))
+	m.Do(func(k, v uint) {
+		assert.Equal(t, v, r.Get(k))
+	})
+
+	// restored map stays fully functional
+	kg.Reset()
+	for i := 0; i < n; i++ {
+		k := kg.Next()
+		r.Inc(k, 1)
+		r.Put(^k, k)
+	}
+	assert.Equal(t, 2*m.Len()-1, r.Len())
+}
+
+func Test_UintMapSnapshotStream(t *testing.T) {
+	m := NewUintMap()
+	for i := uint(1); i < 10000; i++ {
+		m.Put(i, i*i)
+	}
+	var buf bytes.Buffer
+	wn, err := m.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), wn)
+	buf.WriteString("tail")
+
+	r := NewUintMap()
+	rn, err := r.ReadFrom(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, wn, rn)
+	assert.Equal(t, "tail", buf.String())
+	assert.Equal(t, m.Len(), r.Len())
+	for i := uint(1); i < 10000; i++ {
+		assert.Equal(t, i*i, r.Get(i))
+	}
+}
+
+func Test_UintMapSnapshotCorrupted(t *testing.T) {
+	m := NewUintMap()
+	for i := uint(1); i < 5000; i++ {
+		m.Put(i, i)
+	}
+	data, _ := m.MarshalBinary()
+
+	r := NewUintMap()
+	r.Put(5, 55)
+	check := func(d []byte, expected error) {
+		err := r.UnmarshalBinary(d)
+		assert.Error(t, err)
+		if expected != nil {
+			assert.Equal(t, expected, err)
+		}
+		// failed restore leaves map untouched
+		assert.EqualValues(t, 1, r.Len())
+		assert.EqualValues(t, 55, r.Get(5))
+	}
+
+	bad := append([]byte(nil), data...)
+	bad[len(bad)/2] ^= 0x10
+	check(bad, SnapshotChecksumError)
+
+	check(data[:len(data)-1], io.ErrUnexpectedEOF)
+	check(data[:100], io.ErrUnexpectedEOF)
+
+	bad = append([]byte(nil), data...)
+	bad[0] = 'X'
+	check(bad, SnapshotFormatError)
+
+	bad = append([]byte(nil), data...)
+	bad[4] = 99
+	check(bad, SnapshotVersionError)
+
+	check(append(append([]byte(nil), data...), 0), SnapshotFormatError)
+
+	// structural damage with a valid checksum is still rejected
+	bad = append([]byte(nil), data[:len(data)-4]...)
+	for i := 48 + 16; i < len(bad); i += 16 {
+		if binary.LittleEndian.Uint64(bad[i:]) != 0 {
+			binary.LittleEndian.PutUint64(bad[i:], 0xdeadbeef)
+			break
+		}
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(bad, snapshotCrcTable))
+	check(append(bad, sum[:]...), SnapshotFormatError)
+
+	// huge directory of a single bucket is refused before allocation
+	bad = append([]byte(nil), data[:48]...)
+	binary.LittleEndian.PutUint64(bad[8:], bitsPerHashCode-3)        // dirBits
+	binary.LittleEndian.PutUint64(bad[8+3*8:], 0)                    // count
+	binary.LittleEndian.PutUint64(bad[8+4*8:], 1)                    // buckets
+	bad = append(bad, make([]byte, (2+2*entriesPerHashBucket)*8)...) // empty bucket of depth 0
+	binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(bad, snapshotCrcTable))
+	check(append(bad, sum[:]...), SnapshotFormatError)
+
+	s := NewUintSet()
+	sdata, _ := s.MarshalBinary()
+	check(sdata, SnapshotFormatError)
+}
+
+func Test_UintSetSnapshot(t *testing.T) {
+	const n = 200000
+	s := NewUintSet()
+	kg := th.NewSeqGen(th.SgRand)
+	for i := 0; i < n; i++ {
+		s.Add(kg.Next())
+	}
+	s.Add(0)
+
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	r := NewUintSet()
+	_, err = r.ReadFrom(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, s.Len(), r.Len())
+	assert.Equal(t, s.memuse(), r.memuse())
+	assert.True(t, r.Includes(0))
+	kg.Reset()
+	for i := 0; i < n; i++ {
+		assert.True(t, r.Includes(kg.Next()))
+	}
+
+	data, _ := s.MarshalBinary()
+	data[len(data)-1] ^= 1
+	assert.Equal(t, SnapshotChecksumError, r.UnmarshalBinary(data))
+	assert.Equal(t, s.Len(), r.Len())
+}
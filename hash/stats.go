@@ -0,0 +1,161 @@
+package hash
+
+//
+// Structural statistics of hash containers.
+// Collecting them walks the whole container, so it is meant for periodic export and tuning,
+// not for hot paths.
+//
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// number of fill histogram classes, each covers a tenth of bucket capacity
+const statsFillClasses = 10
+
+// probe histogram counts displacements up to this value, longer ones go to the last class
+const statsMaxProbeClass = 16
+
+type Stats struct {
+	Len        uint    // number of elements
+	DirSize    int     // number of directory slots
+	Buckets    int     // number of distinct buckets
+	LoadFactor float64 // elements per bucket slot
+	MemBytes   uint    // memory of buckets and directories (including one being doubled), not counting memory referenced by values
+
+	// FillHistogram[i] is the number of buckets filled by i/10 to (i+1)/10 of capacity,
+	// full buckets are counted in the last class
+	FillHistogram [statsFillClasses]uint
+
+	// ProbeHistogram[i] is the number of entries displaced by i slots from their home slot,
+	// the last class counts all longer displacements
+	ProbeHistogram [statsMaxProbeClass + 1]uint
+	MaxProbe       uint
+	MeanProbe      float64
+
+	// DepthHistogram[i] is the number of buckets with local depth i, its length is directory depth + 1
+	DepthHistogram []uint
+
+	// Counters are not kept in snapshots, ReadFrom resets them to zero
+	Splits uint // bucket splits since creation, Clear or ReadFrom
+	Merges uint // bucket merges since creation, Clear or ReadFrom
+}
+
+func (st *Stats) begin(dirBits uint, dirSize int) {
+	st.DirSize = dirSize
+	st.DepthHistogram = make([]uint, dirBits+1)
+}
+
+func (st *Stats) addBucket(bits, count uint) {
+	st.Buckets++
+	st.DepthHistogram[bits]++
+	c := count * statsFillClasses / entriesPerHashBucket
+	if c == statsFillClasses {
+		c--
+	}
+	st.FillHistogram[c]++
+}
+
+// addEntry counts entry at slot with given home slot
+func (st *Stats) addEntry(slot, home uint) {
+	d := (slot + entriesPerHashBucket - home) % entriesPerHashBucket
+	if d > st.MaxProbe {
+		st.MaxProbe = d
+	}
+	st.MeanProbe += float64(d)
+	if d > statsMaxProbeClass {
+		d = statsMaxProbeClass
+	}
+	st.ProbeHistogram[d]++
+}
+
+func (st *Stats) end(bucketSize uintptr) {
+	if n := st.Len; n > 0 {
+		st.LoadFactor = float64(n) / float64(st.Buckets*entriesPerHashBucket)
+	}
+	var probes uint
+	for _, n := range st.ProbeHistogram {
+		probes += n
+	}
+	if probes > 0 {
+		st.MeanProbe /= float64(probes)
+	}
+	st.MemBytes = uint(st.Buckets)*uint(bucketSize) + uint(st.DirSize)*uint(unsafe.Sizeof(uintptr(0)))
+}
+
+func (st Stats) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "len %d, dir %d, buckets %d, load %.3f, mem %d, splits %d, merges %d\n",
+		st.Len, st.DirSize, st.Buckets, st.LoadFactor, st.MemBytes, st.Splits, st.Merges)
+	fmt.Fprintf(&sb, "fill: %v\n", st.FillHistogram)
+	fmt.Fprintf(&sb, "probe: max %d, mean %.3f, %v\n", st.MaxProbe, st.MeanProbe, st.ProbeHistogram)
+	fmt.Fprintf(&sb, "depth: %v", st.DepthHistogram)
+	return sb.String()
+}
+
+func (m *UintMap) Stats() Stats {
+	st := Stats{Len: m.count, Splits: m.splits, Merges: m.merges}
+	st.begin(m.dirBits, len(m.dir))
+	for di := 0; di < len(m.dir); di++ {
+		b := m.dir[di]
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		st.addBucket(b.bits, b.count)
+		for i := range b.entries {
+			if k := b.entries[i].key; k != 0 {
+				st.addEntry(uint(i), m.hash(k)%entriesPerHashBucket)
+			}
+		}
+	}
+	st.end(unsafe.Sizeof(uumBucket{}))
+	st.MemBytes += uint(len(m.growDir)) * uint(unsafe.Sizeof(uintptr(0)))
+	return st
+}
+
+func (s *UintSet) Stats() Stats {
+	st := Stats{Len: s.count, Splits: s.splits, Merges: s.merges}
+	st.begin(s.dirBits, len(s.dir))
+	for di := 0; di < len(s.dir); di++ {
+		b := s.dir[di]
+		if di > 0 && b == s.dir[di-1] {
+			continue
+		}
+		st.addBucket(b.bits, b.count)
+		for i, v := range b.values {
+			if v != 0 {
+				st.addEntry(uint(i), s.hash(v)%entriesPerHashBucket)
+			}
+		}
+	}
+	st.end(unsafe.Sizeof(usBucket{}))
+	st.MemBytes += uint(len(s.growDir)) * uint(unsafe.Sizeof(uintptr(0)))
+	return st
+}
+
+func (m *GenericHashMap) Stats() Stats {
+	st := Stats{Len: m.count, Splits: m.splits, Merges: m.merges}
+	st.begin(m.dirBits, len(m.dir))
+	for di := 0; di < len(m.dir); di++ {
+		b := m.dir[di]
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		st.addBucket(b.bits, b.count)
+		for i := range b.entries {
+			if k := b.entries[i].key; k != 0 {
+				st.addEntry(uint(i), m.hash(k)%entriesPerHashBucket)
+			}
+		}
+	}
+	st.end(unsafe.Sizeof(genericHashMapBucket{}))
+	return st
+}
+
+// Stats of multimap are those of its UintMap of keys, MemBytes does not include value sets
+// kept outside of it
+func (m *UintMultiMap) Stats() Stats {
+	return m.keys.Stats()
+}
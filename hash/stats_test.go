@@ -0,0 +1,136 @@
+package hash
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func checkStats(t *testing.T, st Stats, entries uint) {
+	var fill, depth, probes uint
+	for _, n := range st.FillHistogram {
+		fill += n
+	}
+	for _, n := range st.DepthHistogram {
+		depth += n
+	}
+	for _, n := range st.ProbeHistogram {
+		probes += n
+	}
+	assert.EqualValues(t, st.Buckets, fill)
+	assert.EqualValues(t, st.Buckets, depth)
+	assert.Equal(t, entries, probes)
+	// every split adds a bucket and every merge removes one
+	assert.EqualValues(t, 1+st.Splits-st.Merges, st.Buckets)
+	assert.True(t, st.MeanProbe <= float64(st.MaxProbe))
+	assert.True(t, st.LoadFactor > 0 && st.LoadFactor <= 1)
+	assert.True(t, st.MemBytes >= uint(st.Buckets)*entriesPerHashBucket*8)
+}
+
+func Test_UintMapStats(t *testing.T) {
+	const n = 100000
+	m := NewUintMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(i, i)
+	}
+	st := m.Stats()
+	assert.EqualValues(t, n, st.Len)
+	assert.Equal(t, m.DirSize(), st.DirSize)
+	assert.Equal(t, m.BucketCount(), st.Buckets)
+	assert.Equal(t, 1<<(len(st.DepthHistogram)-1), st.DirSize)
+	assert.True(t, st.Splits > 0)
+	assert.EqualValues(t, 0, st.Merges)
+	checkStats(t, st, n-1) // zero key has no slot
+
+	for i := uint(0); i < n; i++ {
+		if i%16 != 0 {
+			m.Delete(i)
+		}
+	}
+	m.Compact()
+	st = m.Stats()
+	assert.True(t, st.Merges > 0)
+	checkStats(t, st, n/16-1)
+	assert.NotEmpty(t, st.String())
+
+	m.Clear()
+	st = m.Stats()
+	assert.EqualValues(t, 0, st.Splits)
+	assert.Equal(t, 1, st.Buckets)
+}
+
+func TestUsetStats(t *testing.T) {
+	const n = 100000
+	s := NewUintSet()
+	for i := uint(1); i <= n; i++ {
+		s.Add(i)
+	}
+	st := s.Stats()
+	assert.EqualValues(t, n, st.Len)
+	checkStats(t, st, n)
+	for i := uint(1); i <= n; i += 2 {
+		s.Delete(i)
+	}
+	s.Compact()
+	checkStats(t, s.Stats(), n/2)
+}
+
+func Test_GenericMapStats(t *testing.T) {
+	const n = 100000
+	m := NewMap()
+	for i := uint(1); i <= n; i++ {
+		m.Put(i, i)
+	}
+	st := m.Stats()
+	assert.EqualValues(t, n, st.Len)
+	checkStats(t, st, n)
+	for i := uint(1); i <= n; i++ {
+		if i%16 != 0 {
+			m.Delete(i)
+		}
+	}
+	st = m.Stats()
+	assert.True(t, st.Merges > 0)
+	checkStats(t, st, n/16)
+}
+
+func Test_UintMultiMapStats(t *testing.T) {
+	const n = 100000
+	m := NewUintMultiMap()
+	for i := uint(1); i <= n; i++ {
+		m.Add(i, i)
+		m.Add(i, i+1)
+	}
+	st := m.Stats()
+	assert.EqualValues(t, n, st.Len)
+	assert.True(t, st.Splits > 0)
+	checkStats(t, st, n)
+	for i := uint(1); i <= n; i++ {
+		if i%16 != 0 {
+			m.DeleteKey(i)
+		}
+	}
+	st = m.Stats()
+	assert.True(t, st.Merges > 0)
+	checkStats(t, st, n/16)
+}
+
+func Test_StatsGrowthAndRestore(t *testing.T) {
+	m := NewUintMap(IncrementalGrowth)
+	var i uint
+	for i = 1; m.growDir == nil; i++ {
+		m.Put(i, i)
+	}
+	st := m.Stats()
+	assert.EqualValues(t, uint(st.Buckets)*uint(unsafe.Sizeof(uumBucket{}))+
+		uint(len(m.dir)+len(m.growDir))*uint(unsafe.Sizeof(uintptr(0))), st.MemBytes)
+
+	data, err := m.MarshalBinary()
+	assert.NoError(t, err)
+	assert.True(t, st.Splits > 0)
+	assert.NoError(t, m.UnmarshalBinary(data))
+	st = m.Stats()
+	assert.EqualValues(t, 0, st.Splits)
+	assert.EqualValues(t, i-1, st.Len)
+}
@@ -0,0 +1,138 @@
+package hash
+
+//
+// Sorted exports of UintMap for counting maps.
+// Entries are ordered by value descending, equal values by key ascending.
+// Every export makes one pass over buckets and allocates only the resulting slice.
+//
+
+import "sort"
+
+type UintMapEntry struct {
+	Key, Value uint
+}
+
+// before reports whether a goes before b in value order
+func (a UintMapEntry) before(b UintMapEntry) bool {
+	return a.Value > b.Value || (a.Value == b.Value && a.Key < b.Key)
+}
+
+type entriesByValue []UintMapEntry
+
+func (s entriesByValue) Len() int           { return len(s) }
+func (s entriesByValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s entriesByValue) Less(i, j int) bool { return s[i].before(s[j]) }
+
+type entriesByKey []UintMapEntry
+
+func (s entriesByKey) Len() int           { return len(s) }
+func (s entriesByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s entriesByKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
+
+// each calls f for every entry
+func (m *UintMap) each(f func(e UintMapEntry)) {
+	if m.zeroEntryAssigned {
+		f(UintMapEntry{0, m.zeroEntry.value})
+	}
+	for di := 0; di < len(m.dir); di++ {
+		b := m.dir[di]
+		if di > 0 && b == m.dir[di-1] {
+			continue
+		}
+		for i := range b.entries {
+			if b.entries[i].key != 0 {
+				f(UintMapEntry{b.entries[i].key, b.entries[i].value})
+			}
+		}
+	}
+}
+
+// Entries returns all entries in no particular order
+func (m *UintMap) Entries() []UintMapEntry {
+	r := make([]UintMapEntry, 0, m.count)
+	m.each(func(e UintMapEntry) {
+		r = append(r, e)
+	})
+	return r
+}
+
+// SortedByValue returns all entries ordered by value descending, equal values by key ascending
+func (m *UintMap) SortedByValue() []UintMapEntry {
+	r := m.Entries()
+	sort.Sort(entriesByValue(r))
+	return r
+}
+
+// SortedByKey returns all entries ordered by key ascending
+func (m *UintMap) SortedByKey() []UintMapEntry {
+	r := m.Entries()
+	sort.Sort(entriesByKey(r))
+	return r
+}
+
+// TopK returns up to k entries with largest values, ordered by value descending
+func (m *UintMap) TopK(k int) []UintMapEntry {
+	if k < 0 {
+		panic("negative k")
+	}
+	if uint(k) > m.count {
+		k = int(m.count)
+	}
+	// heap keeps the worst of the best k entries at the root
+	h := make([]UintMapEntry, 0, k)
+	if k == 0 {
+		return h
+	}
+	m.each(func(e UintMapEntry) {
+		if len(h) < k {
+			h = append(h, e)
+			topkUp(h, len(h)-1)
+		} else if e.before(h[0]) {
+			h[0] = e
+			topkDown(h, 0)
+		}
+	})
+	// heap sort: move the worst entry to the end
+	for n := len(h) - 1; n > 0; n-- {
+		h[0], h[n] = h[n], h[0]
+		topkDown(h[:n], 0)
+	}
+	return h
+}
+
+func topkUp(h []UintMapEntry, i int) {
+	for i > 0 {
+		p := (i - 1) / 2
+		if !h[p].before(h[i]) {
+			return
+		}
+		h[p], h[i] = h[i], h[p]
+		i = p
+	}
+}
+
+func topkDown(h []UintMapEntry, i int) {
+	for {
+		worst := i
+		if l := 2*i + 1; l < len(h) && h[worst].before(h[l]) {
+			worst = l
+		}
+		if r := 2*i + 2; r < len(h) && h[worst].before(h[r]) {
+			worst = r
+		}
+		if worst == i {
+			return
+		}
+		h[i], h[worst] = h[worst], h[i]
+		i = worst
+	}
+}
+
+// Histogram returns map of every value to the number of keys having it
+func (m *UintMap) Histogram() *UintMap {
+	r := NewUintMap()
+	m.each(func(e UintMapEntry) {
+		r.Inc(e.Value, 1)
+	})
+	return r
+}
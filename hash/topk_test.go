@@ -0,0 +1,58 @@
+package hash
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UintMapSorted(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewUintMap()
+	model := make(map[uint]uint)
+	for i := 0; i < 100000; i++ {
+		k := uint(rnd.Intn(20000))
+		m.Inc(k, 1)
+		model[k]++
+	}
+	expected := make([]UintMapEntry, 0, len(model))
+	for k, v := range model {
+		expected = append(expected, UintMapEntry{k, v})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Value != expected[j].Value {
+			return expected[i].Value > expected[j].Value
+		}
+		return expected[i].Key < expected[j].Key
+	})
+	assert.Equal(t, expected, m.SortedByValue())
+	for _, k := range []int{0, 1, 7, 100, len(model), len(model) + 10} {
+		top := m.TopK(k)
+		n := k
+		if n > len(model) {
+			n = len(model)
+		}
+		assert.Equal(t, expected[:n], top)
+	}
+
+	byKey := m.SortedByKey()
+	assert.Equal(t, len(model), len(byKey))
+	for i, e := range byKey {
+		assert.Equal(t, model[e.Key], e.Value)
+		if i > 0 {
+			assert.True(t, byKey[i-1].Key < e.Key)
+		}
+	}
+
+	hist := m.Histogram()
+	freq := make(map[uint]uint)
+	for _, v := range model {
+		freq[v]++
+	}
+	assert.EqualValues(t, len(freq), hist.Len())
+	for v, n := range freq {
+		assert.Equal(t, n, hist.Get(v))
+	}
+}
@@ -8,10 +8,6 @@ package hash
 
 // prefix: uum
 
-import (
-	"github.com/pi/goal/md"
-)
-
 type uumEntry struct {
 	key, value uint
 }
@@ -22,33 +18,55 @@ type uumBucket struct {
 	entries [entriesPerHashBucket]uumEntry
 }
 
+// UintMapIterator walks over map entries in no particular order.
+// Map must not be modified during iteration except by DeleteCurrent.
 type UintMapIterator struct {
 	m               *UintMap
 	started         bool
+	deleted         bool // current entry was deleted, its slot must be examined again
 	curBucketIndex  int
 	curElementIndex int
+	mods            uint
+	skip            []uint // visited keys moved ahead of the cursor by DeleteCurrent
 }
 
 func (it *UintMapIterator) Reset() {
 	it.started = false
 }
 
+func (it *UintMapIterator) check() {
+	if it.mods != it.m.mods {
+		panic(ConcurrentModificationError)
+	}
+}
+
 func (it *UintMapIterator) Next() bool {
 	if !it.started {
 		it.started = true
+		it.deleted = false
+		it.skip = it.skip[:0]
+		it.mods = it.m.mods
 		it.curBucketIndex = 0
 		it.curElementIndex = -1
 		if it.m.zeroEntryAssigned {
 			return true
 		}
 	}
+	it.check()
 	if it.curBucketIndex == len(it.m.dir) {
 		return false
 	}
+	if it.deleted {
+		it.deleted = false
+		if it.curElementIndex != -1 {
+			it.curElementIndex--
+		}
+	}
 	for {
 		it.curElementIndex++
 		if it.curElementIndex == entriesPerHashBucket {
 			it.curElementIndex = 0
+			it.skip = it.skip[:0]
 			for {
 				it.curBucketIndex++
 				if it.curBucketIndex == len(it.m.dir) {
@@ -59,17 +77,31 @@ func (it *UintMapIterator) Next() bool {
 				}
 			}
 		}
-		if it.m.dir[it.curBucketIndex].entries[it.curElementIndex].key != 0 {
+		if k := it.m.dir[it.curBucketIndex].entries[it.curElementIndex].key; k != 0 {
+			if len(it.skip) != 0 {
+				var ok bool
+				if it.skip, ok = skipped(it.skip, k); ok {
+					continue
+				}
+			}
 			return true
 		}
 	}
 }
 
-// Return current map key. Panic if the iterator has not been started
-func (it *UintMapIterator) CurKey() uint {
+func (it *UintMapIterator) checkCurrent() {
 	if !it.started {
 		panic("accessing unstarted iterator")
 	}
+	it.check()
+	if it.deleted {
+		panic("current entry deleted")
+	}
+}
+
+// Return current map key. Panic if the iterator has not been started
+func (it *UintMapIterator) CurKey() uint {
+	it.checkCurrent()
 	if it.curElementIndex == -1 {
 		return 0 // zero entry key
 	}
@@ -78,15 +110,34 @@ func (it *UintMapIterator) CurKey() uint {
 
 // Return current map value. Panic if the iterator has not been started.
 func (it *UintMapIterator) Cur() uint {
-	if !it.started {
-		panic("accessing unstarted iter")
-	}
+	it.checkCurrent()
 	if it.curElementIndex == -1 {
 		return it.m.zeroEntry.value
 	}
 	return it.m.dir[it.curBucketIndex].entries[it.curElementIndex].value
 }
 
+// DeleteCurrent removes current entry from the map. Iteration continues with Next as usual,
+// every remaining entry is still visited exactly once.
+func (it *UintMapIterator) DeleteCurrent() {
+	it.checkCurrent()
+	m := it.m
+	if it.curElementIndex == -1 {
+		m.zeroEntryAssigned = false
+		m.count--
+	} else {
+		b := m.dir[it.curBucketIndex]
+		it.skip = appendWrapped(it.skip, it.curElementIndex, func(i int) uint { return b.entries[i].key })
+		m.removeAt(b, uint(it.curElementIndex))
+		b.count--
+		m.count--
+		// no merging here, buckets must stay in place until iteration is over
+	}
+	m.mods++
+	it.mods = m.mods
+	it.deleted = true
+}
+
 //
 // HashMap is uint64->uint64 map
 //
@@ -96,32 +147,25 @@ type UintMap struct {
 	zeroEntryAssigned bool
 	dir               []*uumBucket
 	count             uint
+	hasher            Hasher
+	hashShift         uint            // top hash bits consumed by an enclosing sharded container
+	mods              uint            // structural modification counter for fail-fast iterators
+	splits, merges    uint            // bucket splits and merges since init, reported by Stats
+	alloc             bucketAllocator // off-heap storage, nil for Go heap
+	incremental       bool            // directory is doubled incrementally
+	growDir           []*uumBucket    // directory being doubled, nil if none
+	grown             uint            // number of dir slots copied into growDir
+	robinHood         bool            // buckets use Robin Hood probing
 }
 
+// NewUintMap creates map. Optional arguments are initial directory bits and Hasher.
 func NewUintMap(args ...interface{}) *UintMap {
-	m := &UintMap{}
-	initBits := uint(4)
-	if len(args) > 1 {
-		panic("usage: NewUintMap([initDirBits])")
-	}
-	if len(args) == 1 {
-		if v, ok := args[0].(uint); ok {
-			initBits = v
-		} else if v, ok := args[0].(int); ok {
-			initBits = uint(v)
-		} else if v, ok := args[0].(uint64); ok {
-			initBits = uint(v)
-		} else if v, ok := args[0].(int64); ok {
-			initBits = uint(v)
-		} else {
-			panic("expected integer init size")
-		}
-		if initBits < 2 || initBits > (md.BitsPerUint-3) {
-			panic("invalid init bits")
-		}
+	o := parseContainerOptions(args, "usage: NewUintMap([initDirBits], [hasher])")
+	m := &UintMap{hasher: o.hasher, incremental: o.incremental, robinHood: o.robinHood}
+	if o.offHeap {
+		m.useOffHeap()
 	}
-
-	m.init(initBits)
+	m.init(o.dirBitsOption())
 
 	return m
 }
@@ -129,11 +173,17 @@ func NewUintMap(args ...interface{}) *UintMap {
 func (m *UintMap) init(bits uint) {
 	initSize := 1 << bits
 	m.dirBits = bits
-	m.dir = make([]*uumBucket, initSize)
+	if m.alloc != nil {
+		m.alloc.release()
+	}
+	m.growDir, m.grown = nil, 0
+	m.dir = m.newDir(initSize)
 	m.count = 0
 	m.zeroEntryAssigned = false
+	m.mods++
+	m.splits, m.merges = 0, 0
 
-	firstBucket := &uumBucket{}
+	firstBucket := m.newBucket(0)
 
 	for i := 0; i < initSize; i++ {
 		m.dir[i] = firstBucket
@@ -144,6 +194,13 @@ func (m *UintMap) Clear() {
 	m.init(defaultHashDirBits)
 }
 
+func (m *UintMap) hash(key uint) uint {
+	if m.hasher == nil {
+		return uintHashCode(key) << m.hashShift
+	}
+	return m.hasher.Hash(key) << m.hashShift
+}
+
 // find value for key
 func (m *UintMap) Iterator() UintMapIterator {
 	return UintMapIterator{m: m}
@@ -175,40 +232,17 @@ func (m *UintMap) Delete(key uint) bool {
 		if m.zeroEntryAssigned {
 			m.zeroEntryAssigned = false
 			m.count--
+			m.mods++
 			return true
 		}
 		return false
 	}
-	h := uintHashCode(key)
-	dirIndex := h >> (bitsPerHashCode - m.dirBits)
-	elemIndex := h % entriesPerHashBucket
-	home := elemIndex
-	b := m.dir[dirIndex]
-	for {
-		if b.entries[elemIndex].key == key {
-			break
-		}
-		if b.entries[elemIndex].key == 0 {
-			return false
-		}
-
-		elemIndex = (elemIndex + 1) % entriesPerHashBucket
-		if elemIndex == home {
-			return false
-		}
-	}
-	b.entries[elemIndex].key = 0
-	lastIndex := elemIndex
-	elemIndex = (elemIndex + 1) % entriesPerHashBucket
-	for elemIndex != lastIndex && b.entries[elemIndex].key != 0 {
-		home = uintHashCode(b.entries[elemIndex].key) % entriesPerHashBucket
-		if (lastIndex < elemIndex && (home <= lastIndex || home > elemIndex)) || (lastIndex > elemIndex && home <= lastIndex && home > elemIndex) {
-			b.entries[lastIndex] = b.entries[elemIndex]
-			b.entries[elemIndex].key = 0
-			lastIndex = elemIndex
-		}
-		elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	h := m.hash(key)
+	b, elemIndex, found := m.lookup(key, h)
+	if !found {
+		return false
 	}
+	m.deleteAt(h, b, elemIndex)
 	return true
 }
 func (m *UintMap) Len() uint {
@@ -247,7 +281,7 @@ func (m *UintMap) Do(f func(uint, uint)) {
 }
 
 func (m *UintMap) split(key uint) {
-	h := uintHashCode(key)
+	h := m.hash(key)
 
 	for {
 		dirIndex := h >> (bitsPerHashCode - m.dirBits)
@@ -255,36 +289,47 @@ func (m *UintMap) split(key uint) {
 		if splitBucket.count < entriesPerHashBucket {
 			return // successfully splitted
 		}
+		if m.dirBits == splitBucket.bits && m.growDir != nil {
+			// bucket needs the directory being doubled
+			m.finishGrowth()
+			continue
+		}
 		newBits := splitBucket.bits + 1
+		m.splits++
 
 		var workBuckets [2]*uumBucket
-		workBuckets[0] = &uumBucket{bits: newBits}
-		workBuckets[1] = &uumBucket{bits: newBits}
+		workBuckets[0] = m.newBucket(newBits)
+		workBuckets[1] = m.newBucket(newBits)
 
 		if m.dirBits == splitBucket.bits {
 			// grow directory
 			newDirSize := len(m.dir) * 2
-			newDir := make([]*uumBucket, newDirSize)
+			newDir := m.newDir(newDirSize)
 			for index, b := range m.dir {
 				newDir[2*index] = b
 				newDir[2*index+1] = b
 			}
+			m.freeDir(m.dir)
 			m.dirBits = newBits
 			m.dir = newDir
 			dirIndex *= 2
 		}
 
 		// Copy all elements from split bucket into the new buckets
+		var diff uint
 		for index := 0; index < entriesPerHashBucket; index++ {
-			hash := uintHashCode(splitBucket.entries[index].key)
+			hash := m.hash(splitBucket.entries[index].key)
+			diff |= hash ^ h
 			sel := (hash >> (bitsPerHashCode - newBits)) & 1
 			bp := workBuckets[sel]
-			elemLoc := hash % entriesPerHashBucket
-			for ; bp.entries[elemLoc].key != 0; elemLoc = (elemLoc + 1) % entriesPerHashBucket {
-			}
-			bp.entries[elemLoc] = splitBucket.entries[index]
+			bp.entries[m.place(bp, hash)] = splitBucket.entries[index]
 			bp.count++
 		}
+		if diff == 0 {
+			m.freeBucket(workBuckets[0])
+			m.freeBucket(workBuckets[1])
+			panic(HashCollisionError)
+		}
 
 		// replace splitBucket with first work bucket
 		var di uint
@@ -294,7 +339,7 @@ func (m *UintMap) split(key uint) {
 			if m.dir[i] != splitBucket {
 				break
 			}
-			m.dir[i] = workBuckets[0]
+			m.setDir(i, workBuckets[0])
 		}
 
 		// update the directory with second work bucket
@@ -303,9 +348,111 @@ func (m *UintMap) split(key uint) {
 		dirStart = dirStart << (m.dirBits - newBits)
 
 		for index := dirStart; index < dirEnd; index++ {
-			m.dir[index] = workBuckets[1]
+			m.setDir(index, workBuckets[1])
+		}
+		m.freeBucket(splitBucket)
+		if m.incremental && newBits == m.dirBits && m.growDir == nil {
+			m.startGrowth()
+		}
+	}
+}
+
+// place returns slot for absent key with hash code h in bucket b which is not full.
+// The slot is empty, with Robin Hood probing entries are moved to free it.
+func (m *UintMap) place(b *uumBucket, h uint) uint {
+	elemIndex := h % entriesPerHashBucket
+	if m.robinHood {
+		for d := uint(0); b.entries[elemIndex].key != 0 && m.robinDist(b, elemIndex) >= d; d++ {
+			elemIndex = (elemIndex + 1) % entriesPerHashBucket
+		}
+		m.robinOpen(b, elemIndex)
+		return elemIndex
+	}
+	for ; b.entries[elemIndex].key != 0; elemIndex = (elemIndex + 1) % entriesPerHashBucket {
+	}
+	return elemIndex
+}
+
+// removeAt empties slot elemIndex of bucket b and moves back entries of the probe sequence after it
+func (m *UintMap) removeAt(b *uumBucket, elemIndex uint) {
+	if m.robinHood {
+		m.robinRemoveAt(b, elemIndex)
+		return
+	}
+	b.entries[elemIndex].key = 0
+	lastIndex := elemIndex
+	elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	for elemIndex != lastIndex && b.entries[elemIndex].key != 0 {
+		home := m.hash(b.entries[elemIndex].key) % entriesPerHashBucket
+		if (lastIndex < elemIndex && (home <= lastIndex || home > elemIndex)) || (lastIndex > elemIndex && home <= lastIndex && home > elemIndex) {
+			b.entries[lastIndex] = b.entries[elemIndex]
+			b.entries[elemIndex].key = 0
+			lastIndex = elemIndex
+		}
+		elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	}
+}
+
+// merge joins bucket of hash code h with its buddy while both fit under merge threshold
+func (m *UintMap) merge(h uint) {
+	for {
+		dirIndex := h >> (bitsPerHashCode - m.dirBits)
+		b := m.dir[dirIndex]
+		if b.bits == 0 {
+			return
+		}
+		shift := m.dirBits - b.bits
+		buddy := m.dir[(dirIndex>>shift^1)<<shift]
+		if buddy.bits != b.bits || b.count+buddy.count > mergeHashBucketThreshold {
+			return
+		}
+		// with linear probing entries of b keep their slots, only buddy's entries move
+		for index := 0; index < entriesPerHashBucket; index++ {
+			if buddy.entries[index].key == 0 {
+				continue
+			}
+			b.entries[m.place(b, m.hash(buddy.entries[index].key))] = buddy.entries[index]
+		}
+		b.count += buddy.count
+		b.bits--
+		m.merges++
+		dirStart := (dirIndex >> (shift + 1)) << (shift + 1)
+		dirEnd := dirStart + 1<<(shift+1)
+		for index := dirStart; index < dirEnd; index++ {
+			m.setDir(index, b)
+		}
+		m.freeBucket(buddy)
+	}
+}
+
+// Compact merges underfilled buddy buckets and shrinks the directory to the smallest size
+// the remaining buckets need.
+func (m *UintMap) Compact() {
+	m.mods++
+	m.cancelGrowth()
+	for di := 0; di < len(m.dir); {
+		b := m.dir[di]
+		if b.count <= mergeHashBucketThreshold && b.bits > 0 {
+			m.merge(uint(di) << (bitsPerHashCode - m.dirBits))
+			b = m.dir[di]
+		}
+		for di++; di < len(m.dir) && m.dir[di] == b; di++ {
 		}
 	}
+	for m.dirBits > 0 {
+		for i := 0; i < len(m.dir); i += 2 {
+			if m.dir[i] != m.dir[i+1] {
+				return
+			}
+		}
+		newDir := m.newDir(len(m.dir) / 2)
+		for i := range newDir {
+			newDir[i] = m.dir[2*i]
+		}
+		m.freeDir(m.dir)
+		m.dir = newDir
+		m.dirBits--
+	}
 }
 
 // add entry for key (or reuse existing)
@@ -313,44 +460,83 @@ func (m *UintMap) find(key uint, addIfNotExists bool) *uumEntry {
 	if key == 0 {
 		if !m.zeroEntryAssigned && addIfNotExists {
 			m.zeroEntryAssigned = true
+			m.zeroEntry.value = 0
 			m.count++
+			m.mods++
 		}
 		if m.zeroEntryAssigned {
 			return &m.zeroEntry
 		}
 		return nil
 	}
-	h := uintHashCode(key)
-	dirIndex := h >> (bitsPerHashCode - m.dirBits)
-	elementIndex := h % entriesPerHashBucket
-	b := m.dir[dirIndex]
+	return m.findHashed(key, m.hash(key), addIfNotExists)
+}
+
+// findHashed finds entry for non zero key with hash code h (or adds new one)
+func (m *UintMap) findHashed(key, h uint, addIfNotExists bool) *uumEntry {
+	b, elementIndex, found := m.lookup(key, h)
+	if found {
+		return &b.entries[elementIndex]
+	}
+	if !addIfNotExists {
+		return nil
+	}
+	return m.insertAt(key, h, b, elementIndex)
+}
+
+// lookup returns bucket and slot of non zero key with hash code h. If the key is absent,
+// the slot is the empty one ending its probe sequence (any slot of a full bucket).
+func (m *UintMap) lookup(key, h uint) (b *uumBucket, elementIndex uint, found bool) {
+	if m.robinHood {
+		return m.robinLookup(key, h)
+	}
+	b = m.dir[h>>(bitsPerHashCode-m.dirBits)]
+	elementIndex = h % entriesPerHashBucket
 	homeIndex := elementIndex
 	for {
 		if b.entries[elementIndex].key == key {
-			return &b.entries[elementIndex]
+			return b, elementIndex, true
 		}
 		if b.entries[elementIndex].key == 0 {
-			break
+			return b, elementIndex, false
 		}
 		elementIndex = (elementIndex + 1) % entriesPerHashBucket
 		if elementIndex == homeIndex {
-			break
+			return b, elementIndex, false
 		}
 	}
-	// element not found
-	if !addIfNotExists {
-		return nil
-	}
+}
+
+// insertAt adds absent key with hash code h into slot returned by lookup
+func (m *UintMap) insertAt(key, h uint, b *uumBucket, elementIndex uint) *uumEntry {
 	if b.count == entriesPerHashBucket {
 		m.split(key)
-		dirIndex = h >> (bitsPerHashCode - m.dirBits)
-		b = m.dir[dirIndex]
-		elementIndex = h % entriesPerHashBucket
-		for ; b.entries[elementIndex].key != 0; elementIndex = (elementIndex + 1) % entriesPerHashBucket {
-		}
+		b = m.dir[h>>(bitsPerHashCode-m.dirBits)]
+		elementIndex = m.place(b, h)
+	} else if m.robinHood {
+		m.robinOpen(b, elementIndex)
 	}
 	b.count++
-	b.entries[elementIndex].key = key
+	// deleted entries keep their values
+	b.entries[elementIndex] = uumEntry{key: key}
 	m.count++
+	m.mods++
+	if m.growDir != nil {
+		m.growStep()
+	}
 	return &b.entries[elementIndex]
 }
+
+// deleteAt deletes entry in slot of bucket b holding key with hash code h
+func (m *UintMap) deleteAt(h uint, b *uumBucket, elementIndex uint) {
+	m.removeAt(b, elementIndex)
+	b.count--
+	m.count--
+	m.mods++
+	if b.count <= mergeHashBucketThreshold {
+		m.merge(h)
+	}
+	if m.growDir != nil {
+		m.growStep()
+	}
+}
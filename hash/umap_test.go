@@ -3,8 +3,8 @@ package hash
 import (
 	"testing"
 
-	. "../internal/testhelpers"
-	"../th"
+	. "github.com/pi/goal/internal/testhelpers"
+	"github.com/pi/goal/th"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -76,6 +76,8 @@ func Test_UintMapDelete(t *testing.T) {
 		}
 	}
 
+	assert.EqualValues(t, N/2, m.Len())
+
 	m.Put(0, 33)
 	assert.Equal(t, m.Get(0), uint(33))
 	m.Delete(0)
@@ -105,6 +107,75 @@ func Test_UintMapDo(t *testing.T) {
 	assert.Equal(t, n, N)
 }
 
+func Test_UintMapShrink(t *testing.T) {
+	const n = 300000
+	m := NewUintMap()
+	kg := th.NewSeqGen(th.SgRand)
+	for i := 0; i < n; i++ {
+		m.Put(kg.Next(), uint(i))
+	}
+	fullBuckets := m.BucketCount()
+	fullDir := m.DirSize()
+
+	kg.Reset()
+	for i := 0; i < n-1000; i++ {
+		assert.True(t, m.Delete(kg.Next()))
+	}
+	assert.EqualValues(t, 1000, m.Len())
+	// buddies are merged while deleting, the directory is left alone
+	assert.True(t, m.BucketCount() < fullBuckets/20)
+	assert.Equal(t, fullDir, m.DirSize())
+
+	m.Compact()
+	assert.True(t, m.DirSize() < fullDir/20)
+	assert.True(t, m.DirSize() >= m.BucketCount())
+	for i := n - 1000; i < n; i++ {
+		assert.Equal(t, uint(i), m.Get(kg.Next()))
+	}
+
+	// compacted map grows back as usual
+	kg.Reset()
+	for i := 0; i < n; i++ {
+		m.Put(kg.Next(), uint(i))
+	}
+	assert.EqualValues(t, n, m.Len())
+	kg.Reset()
+	for i := 0; i < n; i++ {
+		assert.Equal(t, uint(i), m.Get(kg.Next()))
+	}
+
+	m.Clear()
+	m.Put(1, 1)
+	m.Compact()
+	assert.Equal(t, 1, m.DirSize())
+	assert.EqualValues(t, 1, m.Get(1))
+}
+
+func Test_UintMapDeleteModel(t *testing.T) {
+	m := NewUintMap()
+	model := make(map[uint]uint)
+	kg := th.NewSeqGen(th.SgRand)
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 20000; i++ {
+			k := kg.Next() % 50000
+			if (k+uint(round))%3 == 0 {
+				delete(model, k)
+				m.Delete(k)
+			} else {
+				model[k] = k + uint(round)
+				m.Put(k, k+uint(round))
+			}
+		}
+		if round%5 == 4 {
+			m.Compact()
+		}
+		assert.EqualValues(t, len(model), m.Len())
+		for k, v := range model {
+			assert.Equal(t, v, m.Get(k))
+		}
+	}
+}
+
 func Benchmark_WriteWithSequentialPeriodicKeys(b *testing.B) {
 	g := th.NewSeqGen(th.SgSeq)
 	g.SetPeriod(100000)
@@ -113,3 +184,58 @@ func Benchmark_WriteWithSequentialPeriodicKeys(b *testing.B) {
 		m.Put(uint(i), ^uint(i))
 	}
 }
+
+func Test_UintMapIterFailFast(t *testing.T) {
+	m := NewUintMap()
+	for i := uint(0); i < 1000; i++ {
+		m.Put(i, i)
+	}
+	it := m.Iterator()
+	assert.True(t, it.Next())
+	m.Put(it.CurKey(), 7) // value update is not a structural change
+	assert.True(t, it.Next())
+	m.Put(5000, 1)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Next() })
+
+	it = m.Iterator()
+	assert.True(t, it.Next())
+	m.Delete(999)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Cur() })
+}
+
+func Test_UintMapIterDeleteCurrent(t *testing.T) {
+	// enough keys to fill buckets up to the limit, so probe clusters wrap around bucket ends
+	const n = 20000
+	m := NewUintMap()
+	for i := uint(0); i < n; i++ {
+		m.Put(i, i+1)
+	}
+	seen := make(map[uint]bool)
+	del := true
+	for it := m.Iterator(); it.Next(); {
+		k := it.CurKey()
+		assert.False(t, seen[k])
+		seen[k] = true
+		assert.Equal(t, k+1, it.Cur())
+		if del {
+			it.DeleteCurrent()
+			assert.Panics(t, func() { it.CurKey() })
+		}
+		del = !del
+	}
+	assert.Equal(t, n, len(seen))
+	assert.EqualValues(t, n/2, m.Len())
+	cnt := uint(0)
+	m.Do(func(k, v uint) {
+		assert.Equal(t, k+1, v)
+		cnt++
+	})
+	assert.Equal(t, m.Len(), cnt)
+
+	for it := m.Iterator(); it.Next(); {
+		it.DeleteCurrent()
+	}
+	assert.EqualValues(t, 0, m.Len())
+	it := m.Iterator()
+	assert.False(t, it.Next())
+}
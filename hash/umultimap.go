@@ -0,0 +1,328 @@
+package hash
+
+//
+// UintMultiMap
+// Map of uint keys to sets of uint values, built on UintMap: directory, splits, probing and
+// options (Hasher, RobinHood, IncrementalGrowth) are those of the UintMap of keys.
+// The UintMap value of a key is a packed code. A single value below 2^63 is kept inline as
+// value<<1|1, other value sets are in a side table addressed by even codes index<<1:
+// small sets as slices, larger ones promoted to UintSet.
+//
+
+// prefix: umm
+
+const (
+	// values of a key kept in a slice, more values promote the slice to UintSet
+	ummSmallValues = 16
+
+	// largest value which can be kept inline
+	ummMaxInline = 1<<(bitsPerHashCode-1) - 1
+)
+
+// ummValues is side table entry holding value set of a key
+type ummValues struct {
+	small []uint   // values of small sets
+	set   *UintSet // values of promoted sets
+}
+
+type UintMultiMap struct {
+	keys   *UintMap    // key -> packed code of its values
+	values []ummValues // side table
+	free   []uint      // released side table entries
+	hasher Hasher      // hasher of promoted sets
+	mods   uint        // modification counter for fail-fast value iterators
+}
+
+// NewUintMultiMap creates multimap. Optional arguments are those of NewUintMap
+// except OffHeap.
+func NewUintMultiMap(args ...interface{}) *UintMultiMap {
+	const usage = "usage: NewUintMultiMap([initDirBits], [hasher], [RobinHood], [IncrementalGrowth])"
+	o := parseContainerOptions(args, usage)
+	if o.offHeap {
+		panic(usage)
+	}
+	return &UintMultiMap{keys: NewUintMap(args...), hasher: o.hasher}
+}
+
+func (m *UintMultiMap) Clear() {
+	m.keys.Clear()
+	m.values = nil
+	m.free = nil
+	m.mods++
+}
+
+// Len returns number of keys
+func (m *UintMultiMap) Len() uint {
+	return m.keys.Len()
+}
+
+func inlineCode(code uint) bool {
+	return code&1 != 0
+}
+
+// newValues returns side table index of new value set with values
+func (m *UintMultiMap) newValues(values ...uint) uint {
+	var i uint
+	if n := len(m.free); n > 0 {
+		i = m.free[n-1]
+		m.free = m.free[:n-1]
+	} else {
+		i = uint(len(m.values))
+		m.values = append(m.values, ummValues{})
+	}
+	m.values[i].small = append(make([]uint, 0, 4), values...)
+	return i
+}
+
+func (m *UintMultiMap) releaseValues(i uint) {
+	m.values[i] = ummValues{}
+	m.free = append(m.free, i)
+}
+
+// Add adds value to the values of key. Returns false if it was there already.
+func (m *UintMultiMap) Add(key, value uint) bool {
+	count := m.keys.count
+	e := m.keys.find(key, true)
+	if m.keys.count != count {
+		if value <= ummMaxInline {
+			e.value = value<<1 | 1
+		} else {
+			e.value = m.newValues(value) << 1
+		}
+		m.mods++
+		return true
+	}
+	if inlineCode(e.value) {
+		if e.value>>1 == value {
+			return false
+		}
+		e.value = m.newValues(e.value>>1, value) << 1
+		m.mods++
+		return true
+	}
+	vs := &m.values[e.value>>1]
+	if vs.set != nil {
+		if vs.set.Includes(value) {
+			return false
+		}
+		vs.set.Add(value)
+		m.mods++
+		return true
+	}
+	for _, v := range vs.small {
+		if v == value {
+			return false
+		}
+	}
+	m.mods++
+	if len(vs.small) < ummSmallValues {
+		vs.small = append(vs.small, value)
+		return true
+	}
+	// promote
+	vs.set = NewUintSet(m.hasher)
+	for _, v := range vs.small {
+		vs.set.Add(v)
+	}
+	vs.set.Add(value)
+	vs.small = nil
+	return true
+}
+
+// Remove removes value from the values of key. Key without values is deleted.
+// Returns false if there was no such value.
+func (m *UintMultiMap) Remove(key, value uint) bool {
+	e := m.keys.find(key, false)
+	if e == nil {
+		return false
+	}
+	if inlineCode(e.value) {
+		if e.value>>1 != value {
+			return false
+		}
+		m.keys.Delete(key)
+		m.mods++
+		return true
+	}
+	i := e.value >> 1
+	vs := &m.values[i]
+	if vs.set != nil {
+		if !vs.set.Delete(value) {
+			return false
+		}
+		m.mods++
+		if vs.set.Len() < ummSmallValues/2 {
+			// demote, leaving room in the slice so Add after Remove does not promote again
+			small := make([]uint, 0, ummSmallValues)
+			for it := vs.set.Iterator(); it.Next(); {
+				small = append(small, it.Cur())
+			}
+			*vs = ummValues{small: small}
+		}
+		return true
+	}
+	for j, v := range vs.small {
+		if v != value {
+			continue
+		}
+		m.mods++
+		last := len(vs.small) - 1
+		vs.small[j] = vs.small[last]
+		vs.small = vs.small[:last]
+		switch {
+		case last == 0:
+			m.releaseValues(i)
+			m.keys.Delete(key)
+		case last == 1 && vs.small[0] <= ummMaxInline:
+			e.value = vs.small[0]<<1 | 1
+			m.releaseValues(i)
+		}
+		return true
+	}
+	return false
+}
+
+// Count returns number of values of key
+func (m *UintMultiMap) Count(key uint) uint {
+	e := m.keys.find(key, false)
+	switch {
+	case e == nil:
+		return 0
+	case inlineCode(e.value):
+		return 1
+	}
+	vs := &m.values[e.value>>1]
+	if vs.set != nil {
+		return vs.set.Len()
+	}
+	return uint(len(vs.small))
+}
+
+func (m *UintMultiMap) IncludesKey(key uint) bool {
+	return m.keys.Exists(key)
+}
+
+// Includes reports whether value is among the values of key
+func (m *UintMultiMap) Includes(key, value uint) bool {
+	e := m.keys.find(key, false)
+	switch {
+	case e == nil:
+		return false
+	case inlineCode(e.value):
+		return e.value>>1 == value
+	}
+	vs := &m.values[e.value>>1]
+	if vs.set != nil {
+		return vs.set.Includes(value)
+	}
+	for _, v := range vs.small {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteKey deletes key with all its values
+func (m *UintMultiMap) DeleteKey(key uint) bool {
+	e := m.keys.find(key, false)
+	if e == nil {
+		return false
+	}
+	if !inlineCode(e.value) {
+		m.releaseValues(e.value >> 1)
+	}
+	m.keys.Delete(key)
+	m.mods++
+	return true
+}
+
+// Values returns iterator over values of key. Modification of the multimap makes the next
+// access to the iterator panic with ConcurrentModificationError.
+func (m *UintMultiMap) Values(key uint) UintMultiMapValues {
+	it := UintMultiMapValues{i: -1, m: m, mods: m.mods}
+	e := m.keys.find(key, false)
+	switch {
+	case e == nil:
+	case inlineCode(e.value):
+		it.inline, it.hasInline = e.value>>1, true
+	case m.values[e.value>>1].set != nil:
+		it.setIt = m.values[e.value>>1].set.Iterator()
+		it.set = true
+	default:
+		it.values = m.values[e.value>>1].small
+	}
+	return it
+}
+
+// Do calls f for every key and value
+func (m *UintMultiMap) Do(f func(key, value uint)) {
+	m.keys.Do(func(key, code uint) {
+		if inlineCode(code) {
+			f(key, code>>1)
+			return
+		}
+		vs := &m.values[code>>1]
+		if vs.set != nil {
+			for it := vs.set.Iterator(); it.Next(); {
+				f(key, it.Cur())
+			}
+			return
+		}
+		for _, v := range vs.small {
+			f(key, v)
+		}
+	})
+}
+
+// UintMultiMapValues iterates over values of a key
+type UintMultiMapValues struct {
+	values    []uint
+	inline    uint // single value kept inline
+	hasInline bool
+	i         int
+	set       bool
+	setIt     UintSetIterator
+	m         *UintMultiMap
+	mods      uint
+}
+
+func (it *UintMultiMapValues) check() {
+	if it.m != nil && it.mods != it.m.mods {
+		panic(ConcurrentModificationError)
+	}
+}
+
+func (it *UintMultiMapValues) len() int {
+	if it.hasInline {
+		return 1
+	}
+	return len(it.values)
+}
+
+func (it *UintMultiMapValues) Next() bool {
+	it.check()
+	if it.set {
+		return it.setIt.Next()
+	}
+	if it.i+1 >= it.len() {
+		it.i = it.len()
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *UintMultiMapValues) Cur() uint {
+	it.check()
+	if it.set {
+		return it.setIt.Cur()
+	}
+	if it.i < 0 || it.i >= it.len() {
+		panic("no current value")
+	}
+	if it.hasInline {
+		return it.inline
+	}
+	return it.values[it.i]
+}
@@ -0,0 +1,163 @@
+package hash
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UintMultiMapModel(t *testing.T) {
+	m := NewUintMultiMap()
+	model := make(map[uint]map[uint]bool)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300000; i++ {
+		// few keys with many values, many keys with few values
+		var key uint
+		if i%10 == 0 {
+			key = uint(rnd.Intn(20))
+		} else {
+			key = uint(rnd.Intn(20000))
+		}
+		value := uint(rnd.Intn(16))
+		if i%10 == 0 {
+			value = uint(rnd.Intn(200))
+		}
+		if rnd.Intn(3) == 0 {
+			_, ok := model[key][value]
+			assert.Equal(t, ok, m.Remove(key, value))
+			delete(model[key], value)
+			if len(model[key]) == 0 {
+				delete(model, key)
+			}
+		} else {
+			if model[key] == nil {
+				model[key] = make(map[uint]bool)
+			}
+			assert.Equal(t, !model[key][value], m.Add(key, value))
+			model[key][value] = true
+		}
+	}
+	assert.EqualValues(t, len(model), m.Len())
+	for key, values := range model {
+		assert.EqualValues(t, len(values), m.Count(key))
+		n := 0
+		for it := m.Values(key); it.Next(); n++ {
+			assert.True(t, values[it.Cur()])
+		}
+		assert.Equal(t, len(values), n)
+	}
+	total := 0
+	m.Do(func(key, value uint) {
+		assert.True(t, model[key][value])
+		total++
+	})
+	n := 0
+	for _, values := range model {
+		n += len(values)
+	}
+	assert.Equal(t, n, total)
+
+	for key := range model {
+		if key%2 == 0 {
+			assert.True(t, m.DeleteKey(key))
+			delete(model, key)
+		}
+	}
+	assert.EqualValues(t, len(model), m.Len())
+	for key := uint(0); key < 20000; key++ {
+		assert.Equal(t, model[key] != nil, m.IncludesKey(key))
+		assert.EqualValues(t, len(model[key]), m.Count(key))
+	}
+}
+
+func Test_UintMultiMapPromote(t *testing.T) {
+	m := NewUintMultiMap()
+	for v := uint(0); v < 100; v++ {
+		assert.True(t, m.Add(7, v))
+		assert.False(t, m.Add(7, v))
+	}
+	assert.EqualValues(t, 100, m.Count(7))
+	for v := uint(0); v < 99; v++ {
+		assert.True(t, m.Remove(7, v))
+		assert.True(t, m.Includes(7, 99))
+		assert.False(t, m.Includes(7, v))
+	}
+	assert.EqualValues(t, 1, m.Count(7))
+	assert.True(t, m.Remove(7, 99))
+	assert.False(t, m.IncludesKey(7))
+	assert.EqualValues(t, 0, m.Len())
+	it := m.Values(7)
+	assert.False(t, it.Next())
+}
+
+func Test_UintMultiMapRemoveAllPromoted(t *testing.T) {
+	m := NewUintMultiMap()
+	for _, k := range []uint{0, 7, 8} {
+		for v := uint(0); v < 10; v++ {
+			m.Add(k, v)
+		}
+	}
+	// remove in the order of the promoted set, then in reverse insertion order
+	var values []uint
+	for it := m.Values(7); it.Next(); {
+		values = append(values, it.Cur())
+	}
+	for _, v := range values {
+		assert.True(t, m.Remove(7, v))
+	}
+	assert.False(t, m.IncludesKey(7))
+	for _, k := range []uint{0, 8} {
+		for v := uint(10); v > 0; v-- {
+			assert.True(t, m.Remove(k, v-1))
+		}
+		assert.False(t, m.IncludesKey(k))
+		assert.False(t, m.Remove(k, 0))
+	}
+	assert.EqualValues(t, 0, m.Len())
+}
+
+func Test_UintMultiMapValuesFailFast(t *testing.T) {
+	m := NewUintMultiMap()
+	m.Add(1, 1)
+	m.Add(1, 2)
+	it := m.Values(1)
+	assert.True(t, it.Next())
+	m.Add(2, 1)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Next() })
+	it = m.Values(1)
+	assert.True(t, it.Next())
+	assert.False(t, m.Add(1, 1))
+	assert.True(t, it.Next())
+	m.Remove(1, 1)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Cur() })
+}
+
+func Test_UintMultiMapCodes(t *testing.T) {
+	for _, m := range []*UintMultiMap{NewUintMultiMap(), NewUintMultiMap(RobinHood, IncrementalGrowth, WyHasher{Seed: 3})} {
+		// values which can't be kept inline go to the side table even when single
+		big := uint(ummMaxInline + 1)
+		for k := uint(0); k < 1000; k++ {
+			assert.True(t, m.Add(k, k))
+			assert.True(t, m.Add(k+1000, big+k))
+		}
+		assert.EqualValues(t, 2000, m.Len())
+		assert.Equal(t, 1000, len(m.values))
+		for k := uint(0); k < 1000; k++ {
+			assert.True(t, m.Includes(k, k))
+			assert.True(t, m.Includes(k+1000, big+k))
+			assert.False(t, m.Includes(k+1000, k))
+			assert.True(t, m.Add(k, big))
+			assert.True(t, m.Remove(k, big))
+		}
+		// single inline value after a removal releases its side table entry for reuse
+		assert.Equal(t, 1001, len(m.values))
+		assert.Equal(t, 1, len(m.free))
+		for k := uint(0); k < 1000; k++ {
+			assert.True(t, m.Remove(k+1000, big+k))
+		}
+		assert.EqualValues(t, 1000, m.Len())
+		assert.Equal(t, len(m.values), len(m.free))
+		assert.Panics(t, func() { NewUintMultiMap(OffHeap) })
+	}
+}
@@ -0,0 +1,86 @@
+package hash
+
+//
+// Read-modify-write operations of UintMap.
+// Each of them locates the key once: check and update share one probe sequence.
+//
+
+// GetOk returns value of key and whether the key is present, unlike Get it tells
+// a stored zero from an absent key
+func (m *UintMap) GetOk(key uint) (uint, bool) {
+	e := m.find(key, false)
+	if e == nil {
+		return 0, false
+	}
+	return e.value, true
+}
+
+// GetOrPut returns value of key if it is present (loaded is true), otherwise puts value
+func (m *UintMap) GetOrPut(key, value uint) (actual uint, loaded bool) {
+	count := m.count
+	e := m.find(key, true)
+	if m.count == count {
+		return e.value, true
+	}
+	e.value = value
+	return value, false
+}
+
+// Swap puts newValue and returns oldValue, loaded reports whether the key was present
+func (m *UintMap) Swap(key, newValue uint) (oldValue uint, loaded bool) {
+	count := m.count
+	e := m.find(key, true)
+	oldValue, loaded = e.value, m.count == count
+	e.value = newValue
+	return oldValue, loaded
+}
+
+// CompareAndSwap puts newValue for present key if its value is oldValue
+func (m *UintMap) CompareAndSwap(key, oldValue, newValue uint) bool {
+	e := m.find(key, false)
+	if e == nil || e.value != oldValue {
+		return false
+	}
+	e.value = newValue
+	return true
+}
+
+// Update calls f with value of key and whether it is present. If f returns keep, the key gets
+// the returned value, otherwise it is deleted (or stays absent). f must not modify the map.
+func (m *UintMap) Update(key uint, f func(old uint, exists bool) (value uint, keep bool)) {
+	if key == 0 {
+		var old uint
+		if m.zeroEntryAssigned {
+			old = m.zeroEntry.value
+		}
+		value, keep := f(old, m.zeroEntryAssigned)
+		switch {
+		case keep:
+			if !m.zeroEntryAssigned {
+				m.zeroEntryAssigned = true
+				m.count++
+				m.mods++
+			}
+			m.zeroEntry.value = value
+		case m.zeroEntryAssigned:
+			m.zeroEntryAssigned = false
+			m.count--
+			m.mods++
+		}
+		return
+	}
+	h := m.hash(key)
+	b, i, found := m.lookup(key, h)
+	if found {
+		value, keep := f(b.entries[i].value, true)
+		if keep {
+			b.entries[i].value = value
+		} else {
+			m.deleteAt(h, b, i)
+		}
+		return
+	}
+	if value, keep := f(0, false); keep {
+		m.insertAt(key, h, b, i).value = value
+	}
+}
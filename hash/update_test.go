@@ -0,0 +1,97 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UintMapGetOk(t *testing.T) {
+	m := NewUintMap()
+	for _, k := range []uint{0, 5} {
+		_, ok := m.GetOk(k)
+		assert.False(t, ok)
+		m.Put(k, 0)
+		v, ok := m.GetOk(k)
+		assert.True(t, ok)
+		assert.Equal(t, uint(0), v)
+		// deleted keys start from zero again
+		m.Put(k, 10)
+		m.Delete(k)
+		m.Inc(k, 1)
+		assert.Equal(t, uint(1), m.Get(k))
+	}
+}
+
+func Test_UintMapGetOrPutSwap(t *testing.T) {
+	m := NewUintMap()
+	for _, k := range []uint{0, 7} {
+		v, loaded := m.GetOrPut(k, 3)
+		assert.Equal(t, uint(3), v)
+		assert.False(t, loaded)
+		v, loaded = m.GetOrPut(k, 4)
+		assert.Equal(t, uint(3), v)
+		assert.True(t, loaded)
+
+		v, loaded = m.Swap(k, 5)
+		assert.Equal(t, uint(3), v)
+		assert.True(t, loaded)
+		m.Delete(k)
+		v, loaded = m.Swap(k, 6)
+		assert.Equal(t, uint(0), v)
+		assert.False(t, loaded)
+		assert.Equal(t, uint(6), m.Get(k))
+
+		assert.False(t, m.CompareAndSwap(k, 5, 8))
+		assert.True(t, m.CompareAndSwap(k, 6, 8))
+		assert.Equal(t, uint(8), m.Get(k))
+		assert.False(t, m.CompareAndSwap(k+100, 0, 1))
+		assert.False(t, m.Exists(k+100))
+	}
+	assert.EqualValues(t, 2, m.Len())
+}
+
+func Test_UintMapUpdate(t *testing.T) {
+	const n = 100000
+	m := NewUintMap()
+	model := make(map[uint]uint)
+	// counts with deletion at a limit, enough keys to split and merge buckets
+	for i := uint(0); i < 4*n; i++ {
+		k := i * 7919 % n
+		m.Update(k, func(old uint, exists bool) (uint, bool) {
+			want, ok := model[k]
+			assert.Equal(t, ok, exists)
+			assert.Equal(t, want, old)
+			if old == 2 {
+				return 0, false
+			}
+			return old + 1, true
+		})
+		if model[k] == 2 {
+			delete(model, k)
+		} else {
+			model[k]++
+		}
+	}
+	assert.EqualValues(t, len(model), m.Len())
+	for k, v := range model {
+		assert.Equal(t, v, m.Get(k))
+	}
+	// absent key may stay absent
+	m.Update(n+1, func(old uint, exists bool) (uint, bool) {
+		assert.False(t, exists)
+		return 1, false
+	})
+	assert.False(t, m.Exists(n+1))
+	assert.EqualValues(t, len(model), m.Len())
+
+	m.Clear()
+	for i := uint(0); i < n; i++ {
+		m.Update(i, func(uint, bool) (uint, bool) { return i, true })
+	}
+	for i := uint(0); i < n; i++ {
+		m.Update(i, func(uint, bool) (uint, bool) { return 0, false })
+	}
+	assert.EqualValues(t, 0, m.Len())
+	assert.Equal(t, 1, m.BucketCount())
+}
@@ -10,7 +10,8 @@ package hash
 //
 // UintSet contains unsigned integers without repetitions.
 //
-// CAUTION: never modify set during iteration!
+// CAUTION: never modify set during iteration! Iterators panic when they detect it,
+// use UintSetIterator.DeleteCurrent to remove elements while iterating.
 //
 type UintSet struct {
 	dirBits uint        // current tree level
@@ -18,6 +19,16 @@ type UintSet struct {
 	dir     []*usBucket // flatten tree of buckets
 	count   uint        // number of elements in set (for speed up access to count)
 	w       bool        // write flag, used with race detector
+	hasher  Hasher
+	shift   uint            // top hash bits consumed by an enclosing sharded container
+	mods    uint            // structural modification counter for fail-fast iterators
+	splits  uint            // bucket splits since init, reported by Stats
+	merges  uint            // bucket merges since init, reported by Stats
+	alloc   bucketAllocator // off-heap storage, nil for Go heap
+
+	incremental bool        // directory is doubled incrementally
+	growDir     []*usBucket // directory being doubled, nil if none
+	grown       uint        // number of dir slots copied into growDir
 }
 
 type usBucket struct {
@@ -26,6 +37,13 @@ type usBucket struct {
 	values [entriesPerHashBucket]uint
 }
 
+func (s *UintSet) hash(value uint) uint {
+	if s.hasher == nil {
+		return uintHashCode(value) << s.shift
+	}
+	return s.hasher.Hash(value) << s.shift
+}
+
 func (s *UintSet) readaccess() {
 	if s.w {
 		panic("concurrent read/write")
@@ -76,6 +94,7 @@ func (s *UintSet) seekNext(bi, ei int) (int, int) {
 		if bi == len(s.dir) {
 			return -1, -1
 		}
+		ei = 0
 	}
 }
 func (s *UintSet) seekTo(elt uint) (int, int) {
@@ -90,7 +109,7 @@ func (s *UintSet) seekTo(elt uint) (int, int) {
 		}
 	}
 	// locate prev element's slot
-	valueHash := uintHashCode(elt)
+	valueHash := s.hash(elt)
 	bi := int(valueHash >> (bitsPerHashCode - s.dirBits))
 	ei := int(valueHash % entriesPerHashBucket)
 	b := s.dir[bi]
@@ -111,46 +130,127 @@ func (s *UintSet) seekTo(elt uint) (int, int) {
 
 //
 // UintSetIterator allows iteration over set.
-// CAUTION: never modify set during iteration!
+// Set must not be modified during iteration except by DeleteCurrent.
 //
 type UintSetIterator struct {
 	s                               *UintSet
 	started                         bool
+	deleted                         bool // current element was deleted, its slot must be examined again
 	curBucketIndex, curElementIndex int
+	mods                            uint
+	skip                            []uint // visited values moved ahead of the cursor by DeleteCurrent
 }
 
 func (it *UintSetIterator) Reset() {
 	it.started = false
 }
 
+func (it *UintSetIterator) check() {
+	if it.mods != it.s.mods {
+		panic(ConcurrentModificationError)
+	}
+}
+
+func (it *UintSetIterator) start() {
+	it.started = true
+	it.deleted = false
+	it.skip = it.skip[:0]
+	it.mods = it.s.mods
+}
+
 func (it *UintSetIterator) Next() bool {
 	if !it.started {
-		it.started = true
+		it.start()
 		it.curBucketIndex, it.curElementIndex = it.s.seekFirst()
-	} else {
-		it.curBucketIndex, it.curElementIndex = it.s.seekNext(it.curBucketIndex, it.curElementIndex)
+		return it.curBucketIndex != -1
 	}
-	return it.curBucketIndex != -1
+	it.check()
+	bi, ei := it.curBucketIndex, it.curElementIndex
+	if bi == -1 {
+		return false
+	}
+	if it.deleted {
+		it.deleted = false
+		if ei != -1 {
+			if v := it.s.dir[bi].values[ei]; v != 0 && !it.skipped(v) {
+				return true
+			}
+		}
+	}
+	for {
+		nbi, nei := it.s.seekNext(bi, ei)
+		if nbi != bi {
+			it.skip = it.skip[:0]
+		}
+		it.curBucketIndex, it.curElementIndex = nbi, nei
+		if nbi == -1 || !it.skipped(it.s.dir[nbi].values[nei]) {
+			return nbi != -1
+		}
+		bi, ei = nbi, nei
+	}
+}
+
+func (it *UintSetIterator) skipped(v uint) bool {
+	if len(it.skip) == 0 {
+		return false
+	}
+	var ok bool
+	it.skip, ok = skipped(it.skip, v)
+	return ok
 }
+
 func (it *UintSetIterator) Cur() uint {
-	if !it.started {
+	if !it.started || it.curBucketIndex == -1 || it.deleted {
 		panic("no current element")
 	}
+	it.check()
 	if it.curElementIndex == -1 {
 		return 0
 	}
 	return it.s.dir[it.curBucketIndex].values[it.curElementIndex]
 }
 func (it *UintSetIterator) Seek(target uint) bool {
+	it.start()
 	it.curBucketIndex, it.curElementIndex = it.s.seekTo(target)
 	return it.curBucketIndex != -1
 }
 
+// DeleteCurrent removes current element from the set. Iteration continues with Next as usual,
+// every remaining element is still visited exactly once.
+func (it *UintSetIterator) DeleteCurrent() {
+	if !it.started || it.curBucketIndex == -1 || it.deleted {
+		panic("no current element")
+	}
+	it.check()
+	s := it.s
+	if it.curElementIndex == -1 {
+		s.hasZero = false
+	} else {
+		b := s.dir[it.curBucketIndex]
+		it.skip = appendWrapped(it.skip, it.curElementIndex, func(i int) uint { return b.values[i] })
+		s.removeAt(b, uint(it.curElementIndex))
+		b.count--
+		// no merging here, buckets must stay in place until iteration is over
+	}
+	s.count--
+	s.mods++
+	it.mods = s.mods
+	it.deleted = true
+}
+
 // UintSet methods
 
-func NewUintSet() *UintSet {
-	s := &UintSet{}
-	s.init(4)
+// NewUintSet creates set. Optional arguments are initial directory bits and Hasher.
+func NewUintSet(args ...interface{}) *UintSet {
+	o := parseContainerOptions(args, "usage: NewUintSet([initDirBits], [hasher])")
+	if o.robinHood {
+		panic("usage: NewUintSet([initDirBits], [hasher])")
+	}
+	s := &UintSet{hasher: o.hasher, incremental: o.incremental}
+	if o.offHeap {
+		s.useOffHeap()
+	}
+	s.init(o.dirBitsOption())
 
 	return s
 }
@@ -174,8 +274,12 @@ func (s *UintSet) Clone() *UintSet {
 	}
 	r := &UintSet{}
 	r.count = s.count
+	r.hasZero = s.hasZero
 	r.dir = make([]*usBucket, len(s.dir))
 	r.dirBits = s.dirBits
+	r.hasher = s.hasher
+	r.shift = s.shift
+	r.incremental = s.incremental
 	for i, b := range s.dir {
 		if i == 0 || s.dir[i] != s.dir[i-1] {
 			bc := *b
@@ -190,7 +294,7 @@ func (s *UintSet) Clone() *UintSet {
 // Copy returns a set with all of the receiver's elements.
 func (s *UintSet) Copy() *UintSet {
 	r := NewUintSet()
-	for it := r.Iterator(); it.Next(); {
+	for it := s.Iterator(); it.Next(); {
 		r.Add(it.Cur())
 	}
 	return r
@@ -231,6 +335,7 @@ func (s *UintSet) Add(value uint) {
 		if !s.hasZero {
 			s.hasZero = true
 			s.count++
+			s.mods++
 		}
 	} else {
 		s.find(value, true)
@@ -246,11 +351,16 @@ func (s *UintSet) Delete(value uint) bool {
 		if s.hasZero {
 			s.hasZero = false
 			s.count--
+			s.mods++
 			return true
 		}
 		return false
 	}
-	h := uintHashCode(value)
+	return s.deleteHashed(value, s.hash(value))
+}
+
+// deleteHashed deletes non zero value with hash code h
+func (s *UintSet) deleteHashed(value, h uint) bool {
 	dirIndex := h >> (bitsPerHashCode - s.dirBits)
 	elemIndex := h % entriesPerHashBucket
 	home := elemIndex
@@ -268,19 +378,16 @@ func (s *UintSet) Delete(value uint) bool {
 			return false
 		}
 	}
-	b.values[elemIndex] = 0
-	lastIndex := elemIndex
-	elemIndex = (elemIndex + 1) % entriesPerHashBucket
-	for (elemIndex != lastIndex) && (b.values[elemIndex] != 0) {
-		home = uintHashCode(b.values[elemIndex]) % entriesPerHashBucket
-		if (lastIndex < elemIndex && (home <= lastIndex || home > elemIndex)) || (lastIndex > elemIndex && home <= lastIndex && home > elemIndex) {
-			b.values[lastIndex] = b.values[elemIndex]
-			b.values[elemIndex] = 0
-			lastIndex = elemIndex
-		}
-		elemIndex = (elemIndex + 1) % entriesPerHashBucket
-	}
+	s.removeAt(b, elemIndex)
+	b.count--
 	s.count--
+	s.mods++
+	if b.count <= mergeHashBucketThreshold {
+		s.merge(h)
+	}
+	if s.growDir != nil {
+		s.growStep()
+	}
 	return true
 }
 
@@ -324,9 +431,15 @@ func (s *UintSet) Union(o *UintSet) *UintSet {
 func (s *UintSet) init(dirBits uint) {
 	initSize := 1 << dirBits
 	s.dirBits = dirBits
-	s.dir = make([]*usBucket, initSize)
+	if s.alloc != nil {
+		s.alloc.release()
+	}
+	s.growDir, s.grown = nil, 0
+	s.dir = s.newDir(initSize)
 	s.count = 0
 	s.hasZero = false
+	s.mods++
+	s.splits, s.merges = 0, 0
 
 	firstBucket := s.newBucket(0)
 
@@ -335,19 +448,22 @@ func (s *UintSet) init(dirBits uint) {
 	}
 }
 
-func (s *UintSet) newBucket(bits uint) *usBucket {
-	return &usBucket{bits: bits}
-}
 
 func (s *UintSet) split(value uint) {
-	h := uintHashCode(value)
+	h := s.hash(value)
 	for {
 		dirIndex := h >> (bitsPerHashCode - s.dirBits)
 		splitBucket := s.dir[dirIndex]
 		if splitBucket.count < entriesPerHashBucket {
 			return // successfully splitted
 		}
+		if s.dirBits == splitBucket.bits && s.growDir != nil {
+			// bucket needs the directory being doubled
+			s.finishGrowth()
+			continue
+		}
 		newBits := splitBucket.bits + 1
+		s.splits++
 
 		var workBuckets [2]*usBucket
 		workBuckets[0] = s.newBucket(newBits)
@@ -356,20 +472,23 @@ func (s *UintSet) split(value uint) {
 		if s.dirBits == splitBucket.bits {
 			// grow directory
 			newDirSize := len(s.dir) * 2
-			newDir := make([]*usBucket, newDirSize)
+			newDir := s.newDir(newDirSize)
 			for index, b := range s.dir {
 				newDir[2*index] = b
 				newDir[2*index+1] = b
 			}
+			s.freeDir(s.dir)
 			s.dirBits = newBits
 			s.dir = newDir
 			dirIndex *= 2
 		}
 
 		/* Copy all elements from split bucket into the new buckets. */
+		var diff uint
 		for index := 0; index < entriesPerHashBucket; index++ {
 			v := splitBucket.values[index]
-			hash := uintHashCode(v)
+			hash := s.hash(v)
+			diff |= hash ^ h
 			sel := (hash >> (bitsPerHashCode - newBits)) & 1
 			bp := workBuckets[sel]
 			elemLoc := hash % entriesPerHashBucket
@@ -378,6 +497,11 @@ func (s *UintSet) split(value uint) {
 			bp.values[elemLoc] = v
 			bp.count++
 		}
+		if diff == 0 {
+			s.freeBucket(workBuckets[0])
+			s.freeBucket(workBuckets[1])
+			panic(HashCollisionError)
+		}
 
 		// replace splitBucket with first work bucket
 		var di uint
@@ -387,7 +511,7 @@ func (s *UintSet) split(value uint) {
 			if s.dir[i] != splitBucket {
 				break
 			}
-			s.dir[i] = workBuckets[0]
+			s.setDir(i, workBuckets[0])
 		}
 
 		// update dict with second bucket
@@ -396,8 +520,100 @@ func (s *UintSet) split(value uint) {
 		dirStart = dirStart << (s.dirBits - newBits)
 
 		for index := dirStart; index < dirEnd; index++ {
-			s.dir[index] = workBuckets[1]
+			s.setDir(index, workBuckets[1])
+		}
+		s.freeBucket(splitBucket)
+		if s.incremental && newBits == s.dirBits && s.growDir == nil {
+			s.startGrowth()
+		}
+	}
+}
+
+// removeAt empties slot elemIndex of bucket b and moves back values of the probe sequence after it
+func (s *UintSet) removeAt(b *usBucket, elemIndex uint) {
+	b.values[elemIndex] = 0
+	lastIndex := elemIndex
+	elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	for (elemIndex != lastIndex) && (b.values[elemIndex] != 0) {
+		home := s.hash(b.values[elemIndex]) % entriesPerHashBucket
+		if (lastIndex < elemIndex && (home <= lastIndex || home > elemIndex)) || (lastIndex > elemIndex && home <= lastIndex && home > elemIndex) {
+			b.values[lastIndex] = b.values[elemIndex]
+			b.values[elemIndex] = 0
+			lastIndex = elemIndex
 		}
+		elemIndex = (elemIndex + 1) % entriesPerHashBucket
+	}
+}
+
+// merge joins bucket of hash code h with its buddy while both fit under merge threshold
+func (s *UintSet) merge(h uint) {
+	for {
+		dirIndex := h >> (bitsPerHashCode - s.dirBits)
+		b := s.dir[dirIndex]
+		if b.bits == 0 {
+			return
+		}
+		shift := s.dirBits - b.bits
+		buddy := s.dir[(dirIndex>>shift^1)<<shift]
+		if buddy.bits != b.bits || b.count+buddy.count > mergeHashBucketThreshold {
+			return
+		}
+		// values of b keep their slots, only buddy's values move
+		for _, v := range buddy.values {
+			if v == 0 {
+				continue
+			}
+			elemLoc := s.hash(v) % entriesPerHashBucket
+			for ; b.values[elemLoc] != 0; elemLoc = (elemLoc + 1) % entriesPerHashBucket {
+			}
+			b.values[elemLoc] = v
+		}
+		b.count += buddy.count
+		b.bits--
+		s.merges++
+		dirStart := (dirIndex >> (shift + 1)) << (shift + 1)
+		dirEnd := dirStart + 1<<(shift+1)
+		for index := dirStart; index < dirEnd; index++ {
+			s.setDir(index, b)
+		}
+		s.freeBucket(buddy)
+	}
+}
+
+// Compact merges underfilled buddy buckets and shrinks the directory to the smallest size
+// the remaining buckets need.
+func (s *UintSet) Compact() {
+	if race {
+		s.beginWrite()
+		defer s.endWrite()
+	}
+	if s.dir == nil {
+		return
+	}
+	s.mods++
+	s.cancelGrowth()
+	for di := 0; di < len(s.dir); {
+		b := s.dir[di]
+		if b.count <= mergeHashBucketThreshold && b.bits > 0 {
+			s.merge(uint(di) << (bitsPerHashCode - s.dirBits))
+			b = s.dir[di]
+		}
+		for di++; di < len(s.dir) && s.dir[di] == b; di++ {
+		}
+	}
+	for s.dirBits > 0 {
+		for i := 0; i < len(s.dir); i += 2 {
+			if s.dir[i] != s.dir[i+1] {
+				return
+			}
+		}
+		newDir := s.newDir(len(s.dir) / 2)
+		for i := range newDir {
+			newDir[i] = s.dir[2*i]
+		}
+		s.freeDir(s.dir)
+		s.dir = newDir
+		s.dirBits--
 	}
 }
 
@@ -406,7 +622,11 @@ func (s *UintSet) find(value uint, addIfNotExists bool) bool {
 	if s.dir == nil {
 		s.init(4)
 	}
-	valueHash := uintHashCode(value)
+	return s.findHashed(value, s.hash(value), addIfNotExists)
+}
+
+// findHashed is find for non zero value with hash code valueHash
+func (s *UintSet) findHashed(value, valueHash uint, addIfNotExists bool) bool {
 	dirIndex := valueHash >> (bitsPerHashCode - s.dirBits)
 	elementIndex := valueHash % entriesPerHashBucket
 	b := s.dir[dirIndex]
@@ -438,6 +658,10 @@ func (s *UintSet) find(value uint, addIfNotExists bool) bool {
 	b.count++
 	b.values[elementIndex] = value
 	s.count++
+	s.mods++
+	if s.growDir != nil {
+		s.growStep()
+	}
 	return true
 }
 
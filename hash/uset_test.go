@@ -118,3 +118,91 @@ func TestUsetFirstNext(t *testing.T) {
 	}
 	assert.EqualValues(t, n, 10)
 }
+
+func TestUsetIterMultiBucket(t *testing.T) {
+	s := NewUintSet()
+	for i := uint(0); i < 10000; i++ {
+		s.Add(i)
+	}
+	seen := make(map[uint]bool)
+	for it := s.Iterator(); it.Next(); {
+		assert.False(t, seen[it.Cur()])
+		seen[it.Cur()] = true
+	}
+	assert.EqualValues(t, s.Len(), len(seen))
+}
+
+func TestUsetShrink(t *testing.T) {
+	const n = 300000
+	s := NewUintSet()
+	for i := uint(0); i < n; i++ {
+		s.Add(i)
+	}
+	mem := s.memuse()
+	for i := uint(0); i < n; i++ {
+		if i%300 != 0 {
+			assert.True(t, s.Delete(i))
+		}
+	}
+	assert.EqualValues(t, n/300, s.Len())
+	s.Compact()
+	assert.True(t, s.memuse() < mem/50)
+	for i := uint(0); i < n; i++ {
+		assert.Equal(t, i%300 == 0, s.Includes(i))
+	}
+	n2 := uint(0)
+	for it := s.Iterator(); it.Next(); n2++ {
+	}
+	assert.Equal(t, s.Len(), n2)
+}
+
+func TestUsetIterFailFast(t *testing.T) {
+	s := NewUintSet()
+	for i := uint(0); i < 1000; i++ {
+		s.Add(i)
+	}
+	it := s.Iterator()
+	assert.True(t, it.Next())
+	s.Add(it.Cur()) // already there, nothing changes
+	assert.True(t, it.Next())
+	s.Add(5000)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Next() })
+
+	it = s.Iterator()
+	assert.True(t, it.Next())
+	s.Delete(0)
+	assert.PanicsWithValue(t, ConcurrentModificationError, func() { it.Cur() })
+}
+
+func TestUsetIterDeleteCurrent(t *testing.T) {
+	const n = 20000
+	s := NewUintSet()
+	for i := uint(0); i < n; i++ {
+		s.Add(i)
+	}
+	seen := make(map[uint]bool)
+	del := true
+	for it := s.Iterator(); it.Next(); {
+		v := it.Cur()
+		assert.False(t, seen[v])
+		seen[v] = true
+		if del {
+			it.DeleteCurrent()
+			assert.False(t, s.Includes(v))
+		}
+		del = !del
+	}
+	assert.Equal(t, n, len(seen))
+	assert.EqualValues(t, n/2, s.Len())
+	cnt := uint(0)
+	for it := s.Iterator(); it.Next(); cnt++ {
+	}
+	assert.Equal(t, s.Len(), cnt)
+
+	for it := s.Iterator(); it.Next(); {
+		it.DeleteCurrent()
+	}
+	assert.EqualValues(t, 0, s.Len())
+	_, ok := s.First()
+	assert.False(t, ok)
+}
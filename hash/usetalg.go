@@ -0,0 +1,294 @@
+package hash
+
+//
+// UintSet algebra.
+// Operations walk one operand bucket by bucket and test its values for membership in the other.
+// When both operands compute the same hash codes (same hasher and shift), buckets of both sets
+// are walked pairwise in directory order: a bucket covers a range of hash code prefixes, which
+// is covered by one bucket of the other operand or by a run of its consecutive directory slots.
+// Values are then probed in the paired bucket directly, with hash code computed once.
+// Otherwise every value is looked up in the other operand by its own hash code.
+// New sets returned by operations have hasher, growth and storage options of the receiver,
+// off-heap ones must be released by Free.
+//
+
+// prefix: us
+
+// sameHashes reports whether o computes the same hash codes as s
+func (s *UintSet) sameHashes(o *UintSet) bool {
+	return s.shift == o.shift && sameHasher(s.hasher, o.hasher)
+}
+
+// walk calls f for every non zero value of s with its hash code, in directory order,
+// until f returns false. Reports whether the walk was completed.
+func (s *UintSet) walk(f func(v, h uint) bool) bool {
+	for di := 0; di < len(s.dir); di++ {
+		b := s.dir[di]
+		if di > 0 && b == s.dir[di-1] {
+			continue
+		}
+		for _, v := range b.values {
+			if v != 0 && !f(v, s.hash(v)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pairBucket returns bucket of o covering hash codes of directory slots [lo, hi) of s,
+// nil if they are covered by several buckets of o. s and o must compute the same hash codes.
+func (s *UintSet) pairBucket(o *UintSet, lo, hi int) *usBucket {
+	var first, last int
+	if o.dirBits >= s.dirBits {
+		shift := o.dirBits - s.dirBits
+		first, last = lo<<shift, hi<<shift-1
+	} else {
+		shift := s.dirBits - o.dirBits
+		first, last = lo>>shift, (hi-1)>>shift
+	}
+	if o.dir[first] == o.dir[last] {
+		return o.dir[first]
+	}
+	return nil
+}
+
+// pairIncludes reports whether o includes non zero value v with hash code h.
+// ob is the bucket of o paired with the bucket of v or nil, see pairBucket.
+func (o *UintSet) pairIncludes(ob *usBucket, v, h uint) bool {
+	if ob == nil {
+		ob = o.dir[h>>(bitsPerHashCode-o.dirBits)]
+	}
+	home := h % entriesPerHashBucket
+	for i := home; ; {
+		switch ob.values[i] {
+		case v:
+			return true
+		case 0:
+			return false
+		}
+		if i = (i + 1) % entriesPerHashBucket; i == home {
+			return false
+		}
+	}
+}
+
+// walkIn calls f for every non zero value of s with its hash code and whether o includes it,
+// in directory order, until f returns false. Reports whether the walk was completed.
+func (s *UintSet) walkIn(o *UintSet, f func(v, h uint, in bool) bool) bool {
+	if o.dir == nil || !s.sameHashes(o) {
+		in := s.includer(o)
+		return s.walk(func(v, h uint) bool { return f(v, h, in(v, h)) })
+	}
+	for di := 0; di < len(s.dir); {
+		b := s.dir[di]
+		end := di + 1
+		for end < len(s.dir) && s.dir[end] == b {
+			end++
+		}
+		ob := s.pairBucket(o, di, end)
+		for _, v := range b.values {
+			if v == 0 {
+				continue
+			}
+			h := s.hash(v)
+			if !f(v, h, o.pairIncludes(ob, v, h)) {
+				return false
+			}
+		}
+		di = end
+	}
+	return true
+}
+
+// includer returns membership test of o by hashed lookups, for operands without paired buckets
+func (s *UintSet) includer(o *UintSet) func(v, h uint) bool {
+	if o.dir == nil {
+		return func(uint, uint) bool { return false }
+	}
+	return func(v, _ uint) bool { return o.find(v, false) }
+}
+
+// adder returns function adding non zero values with hash codes of s to r
+func (s *UintSet) adder(r *UintSet) func(v, h uint) bool {
+	if r.dir == nil {
+		r.init(defaultHashDirBits)
+	}
+	if s.sameHashes(r) {
+		return func(v, h uint) bool { r.findHashed(v, h, true); return true }
+	}
+	return func(v, _ uint) bool { r.find(v, true); return true }
+}
+
+// retain deletes non zero values whose membership in o is not keepIn.
+// Emptied buckets are not merged, Compact releases them.
+func (s *UintSet) retain(o *UintSet, keepIn bool) {
+	pair := o.dir != nil && s.sameHashes(o)
+	in := s.includer(o)
+	deleted := false
+	for di := 0; di < len(s.dir); {
+		b := s.dir[di]
+		end := di + 1
+		for end < len(s.dir) && s.dir[end] == b {
+			end++
+		}
+		var ob *usBucket
+		if pair {
+			ob = s.pairBucket(o, di, end)
+		}
+		di = end
+		// backward shift only moves values not visited yet into slot i, or visited ones
+		// into later slots, so every value is examined and none is skipped
+		for i := uint(0); i < entriesPerHashBucket; {
+			v := b.values[i]
+			if v == 0 {
+				i++
+				continue
+			}
+			h := s.hash(v)
+			var has bool
+			if pair {
+				has = o.pairIncludes(ob, v, h)
+			} else {
+				has = in(v, h)
+			}
+			if has != keepIn {
+				s.removeAt(b, i)
+				b.count--
+				s.count--
+				deleted = true
+				continue
+			}
+			i++
+		}
+	}
+	if deleted {
+		s.mods++
+	}
+}
+
+func (s *UintSet) setZero(on bool) {
+	if s.hasZero != on {
+		s.hasZero = on
+		if on {
+			s.count++
+		} else {
+			s.count--
+		}
+		s.mods++
+	}
+}
+
+// newResult creates empty set for results of operations on s, with hasher, growth and
+// off-heap storage options of s
+func (s *UintSet) newResult() *UintSet {
+	r := &UintSet{hasher: s.hasher, incremental: s.incremental}
+	if _, ok := s.alloc.(*offHeapAllocator); ok {
+		r.useOffHeap()
+	}
+	r.init(defaultHashDirBits)
+	return r
+}
+
+// Difference returns set of values of s which are not in o
+func (s *UintSet) Difference(o *UintSet) *UintSet {
+	r := s.newResult()
+	r.setZero(s.hasZero && !o.hasZero)
+	add := s.adder(r)
+	s.walkIn(o, func(v, h uint, in bool) bool {
+		if !in {
+			add(v, h)
+		}
+		return true
+	})
+	return r
+}
+
+// SymmetricDifference returns set of values which are in exactly one of s and o
+func (s *UintSet) SymmetricDifference(o *UintSet) *UintSet {
+	r := s.Difference(o)
+	r.setZero(s.hasZero != o.hasZero)
+	add := o.adder(r)
+	o.walkIn(s, func(v, h uint, in bool) bool {
+		if !in {
+			add(v, h)
+		}
+		return true
+	})
+	return r
+}
+
+// IsSubsetOf reports whether every value of s is in o
+func (s *UintSet) IsSubsetOf(o *UintSet) bool {
+	if s.count > o.count || (s.hasZero && !o.hasZero) {
+		return false
+	}
+	return s.walkIn(o, func(_, _ uint, in bool) bool { return in })
+}
+
+// Equal reports whether s and o contain the same values
+func (s *UintSet) Equal(o *UintSet) bool {
+	return s.count == o.count && s.IsSubsetOf(o)
+}
+
+// UnionWith adds all values of o to s
+func (s *UintSet) UnionWith(o *UintSet) {
+	if s == o {
+		return
+	}
+	if race {
+		s.beginWrite()
+		defer s.endWrite()
+	}
+	add := o.adder(s) // initializes zero value s, so it goes first
+	if o.hasZero {
+		s.setZero(true)
+	}
+	o.walk(add)
+}
+
+// IntersectWith deletes values of s which are not in o
+func (s *UintSet) IntersectWith(o *UintSet) {
+	if s == o {
+		return
+	}
+	if race {
+		s.beginWrite()
+		defer s.endWrite()
+	}
+	if !o.hasZero {
+		s.setZero(false)
+	}
+	s.retain(o, true)
+}
+
+// SubtractWith deletes values of o from s
+func (s *UintSet) SubtractWith(o *UintSet) {
+	if s == o {
+		s.init(defaultHashDirBits)
+		return
+	}
+	if race {
+		s.beginWrite()
+		defer s.endWrite()
+	}
+	if o.hasZero {
+		s.setZero(false)
+	}
+	if s.dir == nil {
+		return
+	}
+	if o.count < s.count {
+		// delete values of o one by one
+		same := o.sameHashes(s)
+		o.walk(func(v, h uint) bool {
+			if !same {
+				h = s.hash(v)
+			}
+			s.deleteHashed(v, h)
+			return true
+		})
+		return
+	}
+	s.retain(o, false)
+}
@@ -0,0 +1,155 @@
+package hash
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type setModel map[uint]bool
+
+func randomSetPair(rnd *rand.Rand, n int, args1, args2 []interface{}) (*UintSet, *UintSet, setModel, setModel) {
+	s, o := NewUintSet(args1...), NewUintSet(args2...)
+	ms, mo := make(setModel), make(setModel)
+	for i := 0; i < n; i++ {
+		v := uint(rnd.Intn(3 * n))
+		if rnd.Intn(2) == 0 {
+			s.Add(v)
+			ms[v] = true
+		}
+		if rnd.Intn(3) == 0 {
+			o.Add(v)
+			mo[v] = true
+		}
+	}
+	return s, o, ms, mo
+}
+
+func assertSetEqualsModel(t *testing.T, s *UintSet, m setModel) {
+	assert.EqualValues(t, len(m), s.Len())
+	for it := s.Iterator(); it.Next(); {
+		assert.True(t, m[it.Cur()])
+	}
+	for v := range m {
+		assert.True(t, s.Includes(v))
+	}
+}
+
+func TestUsetAlgebraModel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	// same hashers pair buckets, different ones use hashed lookups
+	options := [][2][]interface{}{
+		{{}, {}},
+		{{WyHasher{1}}, {WyHasher{1}}},
+		{{}, {WyHasher{2}}},
+		// paired directories of different depth
+		{{2, WyHasher{3}}, {12, WyHasher{3}}},
+		{{12}, {2}},
+		{{IncrementalGrowth}, {}},
+	}
+	for _, opts := range options {
+		for _, n := range []int{0, 1, 10, 1000, 50000} {
+			s, o, ms, mo := randomSetPair(rnd, n, opts[0], opts[1])
+
+			diff, sym, inter, union := make(setModel), make(setModel), make(setModel), make(setModel)
+			subset := true
+			for v := range ms {
+				union[v] = true
+				if mo[v] {
+					inter[v] = true
+				} else {
+					diff[v] = true
+					sym[v] = true
+					subset = false
+				}
+			}
+			for v := range mo {
+				union[v] = true
+				if !ms[v] {
+					sym[v] = true
+				}
+			}
+
+			assertSetEqualsModel(t, s.Difference(o), diff)
+			assertSetEqualsModel(t, s.SymmetricDifference(o), sym)
+			assert.Equal(t, subset, s.IsSubsetOf(o))
+			assert.True(t, inter.isSubsetOf(s, o))
+			assert.Equal(t, len(sym) == 0, s.Equal(o))
+			assert.True(t, s.Equal(s.Clone()))
+			assert.True(t, s.Equal(s.Copy()))
+
+			u := s.Clone()
+			u.UnionWith(o)
+			assertSetEqualsModel(t, u, union)
+			i := s.Clone()
+			i.IntersectWith(o)
+			assertSetEqualsModel(t, i, inter)
+			d := s.Clone()
+			d.SubtractWith(o)
+			assertSetEqualsModel(t, d, diff)
+			// subtract a small set from a large one
+			d = u.Clone()
+			d.SubtractWith(s)
+			for v := range ms {
+				delete(union, v)
+			}
+			assertSetEqualsModel(t, d, union)
+			assert.True(t, i.IsSubsetOf(s) && i.IsSubsetOf(o))
+		}
+	}
+}
+
+// isSubsetOf checks that model is included in both sets
+func (m setModel) isSubsetOf(s, o *UintSet) bool {
+	for v := range m {
+		if !s.Includes(v) || !o.Includes(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUsetPairBucket(t *testing.T) {
+	coarse, fine := NewUintSet(2), NewUintSet(6)
+	for v := uint(1); v <= 20000; v++ {
+		fine.Add(v)
+	}
+	for v := uint(1); v <= 100; v++ {
+		coarse.Add(v)
+	}
+	assert.True(t, fine.dirBits > coarse.dirBits)
+	// every bucket of the fine set lies within one bucket of the coarse one
+	for di := range fine.dir {
+		assert.Equal(t, coarse.dir[di>>(fine.dirBits-coarse.dirBits)], fine.pairBucket(coarse, di, di+1))
+	}
+	// bucket of the coarse set spans many buckets of the fine one
+	assert.Nil(t, coarse.pairBucket(fine, 0, len(coarse.dir)))
+	for v := uint(1); v <= 200; v++ {
+		h := coarse.hash(v)
+		assert.Equal(t, v <= 100, coarse.pairIncludes(nil, v, h))
+		assert.True(t, fine.pairIncludes(nil, v, h))
+	}
+}
+
+func TestUsetAlgebraEdgeCases(t *testing.T) {
+	var empty UintSet
+	s := NewUintSetWith([]uint{0, 1, 2, 3})
+	assert.True(t, empty.IsSubsetOf(s))
+	assert.False(t, s.IsSubsetOf(&empty))
+	assert.EqualValues(t, 4, s.Difference(&empty).Len())
+	assert.EqualValues(t, 4, empty.SymmetricDifference(s).Len())
+
+	empty.UnionWith(s)
+	assert.True(t, empty.Equal(s))
+	s.UnionWith(s)
+	s.IntersectWith(s)
+	assert.EqualValues(t, 4, s.Len())
+	s.SubtractWith(s)
+	assert.EqualValues(t, 0, s.Len())
+
+	z := NewUintSetWith([]uint{0})
+	empty.SubtractWith(z)
+	assert.False(t, empty.Includes(0))
+	assert.EqualValues(t, 3, empty.Len())
+}
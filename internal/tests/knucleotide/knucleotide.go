@@ -16,7 +16,6 @@ import (
 	"log"
 	"os"
 	"runtime"
-	"sort"
 	"time"
 
 	"github.com/pi/goal/hash"
@@ -129,11 +128,11 @@ func readEncDNA() []byte {
 		switch c {
 		case 'a', 'A':
 			c = 0
-		case 't', 'T':
+		case 'c', 'C':
 			c = 1
 		case 'g', 'G':
 			c = 2
-		case 'c', 'C':
+		case 't', 'T':
 			c = 3
 		case '\n':
 			continue
@@ -225,11 +224,11 @@ func compStr(dna string) uint64 {
 		switch c {
 		case 'A':
 			c = 0
-		case 'T':
+		case 'C':
 			c = 1
 		case 'G':
 			c = 2
-		case 'C':
+		case 'T':
 			c = 3
 		}
 		raw[i] = c
@@ -245,11 +244,11 @@ func decompToBytes(compDNA uint64, n int) []byte {
 		case 0:
 			c = 'A'
 		case 1:
-			c = 'T'
+			c = 'C'
 		case 2:
 			c = 'G'
 		case 3:
-			c = 'C'
+			c = 'T'
 		}
 		buf.WriteByte(c)
 		compDNA = compDNA >> 2
@@ -267,35 +266,25 @@ func reverse(s []byte) []byte {
 	return s
 }
 
+// freqReport prints k-mers by frequency. Nucleotide codes are in alphabetical order and
+// the first nucleotide is packed into the highest bits, so ordering equal frequencies by key
+// orders them by nucleotides.
 func freqReport(tbl countMap, n int) string {
-	seqs := make(seqSlice, 0, tbl.Len())
+	m, ok := tbl.(*hash.UintMap)
+	if !ok {
+		m = hash.NewUintMap()
+		tbl.Do(m.Put)
+	}
+	entries := m.SortedByValue()
 	var sum uint64
-	tbl.Do(func(val, count uint) {
-		seqs = append(seqs, seq{nuc: decompToBytes(uint64(val), n), n: uint64(count)})
-		sum += uint64(count)
-	})
-	sort.Sort(seqs)
+	for _, e := range entries {
+		sum += uint64(e.Value)
+	}
 	var buf bytes.Buffer
-	sumFloat, entry := float64(sum), seq{}
-	for _, entry = range seqs {
-		fmt.Fprintf(&buf, "%s %.3f\n", entry.nuc, (100*float64(entry.n))/sumFloat)
+	sumFloat := float64(sum)
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%s %.3f\n", decompToBytes(uint64(e.Key), n), (100*float64(e.Value))/sumFloat)
 	}
 	buf.WriteByte('\n')
 	return buf.String()
 }
-
-type seq struct {
-	nuc []byte
-	n   uint64
-}
-
-type seqSlice []seq
-
-func (seq seqSlice) Len() int      { return len(seq) }
-func (seq seqSlice) Swap(i, j int) { seq[i], seq[j] = seq[j], seq[i] }
-func (seq seqSlice) Less(i, j int) bool {
-	if seq[i].n == seq[j].n {
-		return bytes.Compare(seq[i].nuc, seq[j].nuc) < 0
-	}
-	return seq[i].n > seq[j].n
-}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/gob"
+	"flag"
 	"fmt"
+	"math/bits"
 	"os"
 	"runtime"
 	"strings"
@@ -129,10 +131,294 @@ func testMaps() {
 	fmt.Printf("\ndone\n")
 }
 
+var testName = flag.String("test", "set", "test to run: set, maps, hashers, batch, offheap, cuckoo, latency, probing")
+
 func main() {
-	//testMaps()
-	for i := 0; i < 10; i++ {
-		_, _ = testSet()
+	flag.Parse()
+	switch *testName {
+	case "set":
+		for i := 0; i < 10; i++ {
+			_, _ = testSet()
+		}
+	case "maps":
+		testMaps()
+	case "hashers":
+		testHashers()
+	case "batch":
+		testBatch()
+	case "offheap":
+		testOffHeap()
+	case "cuckoo":
+		testCuckoo()
+	case "latency":
+		testLatency()
+	case "probing":
+		testProbing()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// hostileKeys returns n keys whose default hash codes share top prefixBits bits
+func hostileKeys(n int, prefixBits uint) []uint {
+	const m = 0xc4ceb9fe1a85ec53
+	inv := uint(m)
+	for i := 0; i < 5; i++ {
+		inv *= 2 - m*inv
+	}
+	keys := make([]uint, n)
+	shift := 64 - prefixBits - uint(bits.Len(uint(n)))
+	g := th.NewSeqGen(th.SgSeq)
+	for i := range keys {
+		keys[i] = (g.Next() << shift) * inv
+	}
+	return keys
+}
+
+func testHashers() {
+	const N = 10 * 1000 * 1000
+	const Period = 1000 * 1000
+	hashers := []struct {
+		name string
+		h    hash.Hasher
+	}{
+		{"default", nil},
+		{"multiplicative", hash.MultiplicativeHasher{Seed: hash.RandomSeed()}},
+		{"splitmix64", hash.SplitMix64Hasher{Seed: hash.RandomSeed()}},
+		{"wyhash", hash.WyHasher{Seed: hash.RandomSeed()}},
+	}
+	hostile := hostileKeys(20000, 16)
+
+	fmt.Printf("# hasher\trandom.time\tdir\tbuckets\thostile.time\tdir\tbuckets\tmem\n")
+	for _, h := range hashers {
+		runtime.GC()
+		g := th.NewSeqGen(th.SgRand)
+		g.SetPeriod(Period)
+		m := hash.NewUintMap(h.h)
+		st := time.Now()
+		for i := 0; i < N; i++ {
+			m.Inc(g.Next(), 1)
+		}
+		took := time.Since(st)
+
+		runtime.GC()
+		sm := th.TotalAlloc()
+		hm := hash.NewUintMap(h.h)
+		st = time.Now()
+		for _, k := range hostile {
+			hm.Inc(k, 1)
+		}
+		htook := time.Since(st)
+		fmt.Printf("%s\t%v\t%d\t%d\t%v\t%d\t%d\t%s\n", h.name,
+			took, m.DirSize(), m.BucketCount(),
+			htook, hm.DirSize(), hm.BucketCount(), th.MemSince(sm))
+		fmt.Printf("%v\n", m.Stats())
+	}
+}
+
+// testBatch compares throughput of single key calls and bulk calls of UintMap
+func testBatch() {
+	const N = 10 * 1000 * 1000
+	fmt.Printf("# keys\tInc\tIncMany\tGet\tGetMany\t(Mops/s)\n")
+	for _, period := range []uint{10 * 1000, 1000 * 1000, N} {
+		g := th.NewSeqGen(th.SgRand)
+		g.SetPeriod(period)
+		keys := make([]uint, N)
+		ones := make([]uint, N)
+		for i := range keys {
+			keys[i] = g.Next()
+			ones[i] = 1
+		}
+		out := make([]uint, N)
+		mops := func(f func()) float64 {
+			runtime.GC()
+			st := time.Now()
+			f()
+			return float64(N) / time.Since(st).Seconds() / 1e6
+		}
+
+		m1, m2 := hash.NewUintMap(), hash.NewUintMap()
+		inc := mops(func() {
+			for _, k := range keys {
+				m1.Inc(k, 1)
+			}
+		})
+		incMany := mops(func() { m2.IncMany(keys, ones) })
+		var sum uint
+		get := mops(func() {
+			for _, k := range keys {
+				sum += m1.Get(k)
+			}
+		})
+		getMany := mops(func() { m2.GetMany(keys, out) })
+		for i := range out {
+			sum -= out[i]
+		}
+		if sum != 0 || m1.Len() != m2.Len() {
+			panic("bulk results differ")
+		}
+		fmt.Printf("%dk\t%.1f\t%.1f\t%.1f\t%.1f\n", m1.Len()/1000, inc, incMany, get, getMany)
+	}
+}
+
+// testOffHeap compares heap usage and GC pauses of native map, UintMap and off-heap UintMap
+func testOffHeap() {
+	const N = 10 * 1000 * 1000
+	kinds := []struct {
+		name string
+		fill func(g th.SeqGen) func()
+	}{
+		{"native", func(g th.SeqGen) func() {
+			m := make(map[uint]uint)
+			for i := 0; i < N; i++ {
+				m[g.Next()]++
+			}
+			return func() { runtime.KeepAlive(m) }
+		}},
+		{"UintMap", func(g th.SeqGen) func() {
+			m := hash.NewUintMap()
+			for i := 0; i < N; i++ {
+				m.Inc(g.Next(), 1)
+			}
+			return func() { runtime.KeepAlive(m) }
+		}},
+		{"off-heap", func(g th.SeqGen) func() {
+			m := hash.NewUintMap(hash.OffHeap)
+			for i := 0; i < N; i++ {
+				m.Inc(g.Next(), 1)
+			}
+			return m.Free
+		}},
+	}
+	fmt.Printf("# map\ttime\theap\tGCs\tpauses\tforced GC\n")
+	for _, k := range kinds {
+		g := th.NewSeqGen(th.SgRand)
+		g.SetPeriod(N)
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		st := time.Now()
+		done := k.fill(g)
+		took := time.Since(st)
+		st = time.Now()
+		runtime.GC()
+		gcTook := time.Since(st)
+		runtime.ReadMemStats(&after)
+		fmt.Printf("%s\t%v\t%d MiB\t%d\t%v\t%v\n", k.name, took, (after.HeapAlloc-before.HeapAlloc)>>20,
+			after.NumGC-before.NumGC-1, time.Duration(after.PauseTotalNs-before.PauseTotalNs), gcTook)
+		done()
+	}
+}
+
+// testCuckoo fills cuckoo filters until they are full and measures their false positive rate
+func testCuckoo() {
+	const Probes = 10 * 1000 * 1000
+	fmt.Printf("# capacity\tadded\tload\tfpr\texpected\tadd\tlookup\n")
+	for _, capacity := range []uint{1000, 100 * 1000, 10 * 1000 * 1000} {
+		f := hash.NewCuckooFilter(capacity, hash.NewRandomHasher())
+		g := th.NewSeqGen(th.SgSeq)
+		st := time.Now()
+		for f.Add(g.Next()) {
+		}
+		took := time.Since(st)
+		added := f.Count()
+		fp := 0
+		st = time.Now()
+		for i := 0; i < Probes; i++ {
+			if f.Contains(g.Next()) {
+				fp++
+			}
+		}
+		lookup := time.Since(st)
+		fmt.Printf("%d\t%d\t%.3f\t%.2e\t%.2e\t%v\t%v\n", capacity, added, f.LoadFactor(),
+			float64(fp)/Probes, f.EstimatedFalsePositiveRate(), took/time.Duration(added), lookup/Probes)
+	}
+}
+
+// testLatency measures the slowest Put with and without incremental directory doubling
+func testLatency() {
+	const N = 20 * 1000 * 1000
+	fmt.Printf("# map\ttotal\tmax put\tputs over 100µs\n")
+	for _, k := range []struct {
+		name string
+		args []interface{}
+	}{
+		{"UintMap", nil},
+		{"incremental", []interface{}{hash.IncrementalGrowth}},
+		// off-heap maps are not scanned by GC, leaving directory doubling the only stall
+		{"off-heap", []interface{}{hash.OffHeap}},
+		{"off-heap incremental", []interface{}{hash.OffHeap, hash.IncrementalGrowth}},
+	} {
+		m := hash.NewUintMap(k.args...)
+		g := th.NewSeqGen(th.SgRand)
+		g.SetPeriod(N)
+		var worst time.Duration
+		slow := 0
+		st := time.Now()
+		for i := 0; i < N; i++ {
+			key := g.Next()
+			pst := time.Now()
+			m.Put(key, key)
+			d := time.Since(pst)
+			if d > worst {
+				worst = d
+			}
+			if d > 100*time.Microsecond {
+				slow++
+			}
+		}
+		fmt.Printf("%s\t%v\t%v\t%d\n", k.name, time.Since(st), worst, slow)
+		m.Free()
+	}
+}
+
+// testProbing compares lookups with linear and Robin Hood probing by bucket fill and hit ratio.
+// Buckets of uniformly hashed keys split at about the same time, so their fill follows size
+// of the map through the cycle of directory doublings.
+func testProbing() {
+	const Lookups = 10 * 1000 * 1000
+	const Base = 1 << 20
+	fmt.Printf("# size\tload\thits\tlinear\trobin hood\n")
+	for _, size := range []int{Base, Base * 5 / 4, Base * 3 / 2, Base * 7 / 4, 2*Base - Base/16} {
+		maps := []*hash.UintMap{hash.NewUintMap(), hash.NewUintMap(hash.RobinHood)}
+		g := th.NewSeqGen(th.SgRand)
+		keys := make([]uint, 2*size) // the first half is added, the second one misses
+		for i := range keys {
+			keys[i] = g.Next()
+		}
+		for _, m := range maps {
+			for _, k := range keys[:size] {
+				m.Put(k, k)
+			}
+		}
+		st := maps[0].Stats()
+		for _, hits := range []int{0, 50, 90, 100} {
+			probes := make([]uint, Lookups)
+			for i := range probes {
+				j := i % size
+				if i%100 >= hits {
+					j += size
+				}
+				probes[i] = keys[j]
+			}
+			var took [2]time.Duration
+			for mi, m := range maps {
+				found := 0
+				start := time.Now()
+				for _, k := range probes {
+					if m.Exists(k) {
+						found++
+					}
+				}
+				took[mi] = time.Since(start)
+				if found != Lookups*hits/100 {
+					panic("unexpected lookup result")
+				}
+			}
+			fmt.Printf("%d\t%.2f\t%d%%\t%v\t%v\n", size, st.LoadFactor, hits,
+				took[0]/Lookups, took[1]/Lookups)
+		}
 	}
 }
 
@@ -165,5 +451,6 @@ func testSet() (mem uint64, took time.Duration) {
 	s := fmt.Sprintf("%s\t%s\t%d\t%s\n", label, th.MemSince(sm), th.TotalAllocs()-sa, took.String())
 	f.WriteString(s)
 	print(s)
+	fmt.Printf("%v\n", m.Stats())
 	return mem, took
 }